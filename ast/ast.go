@@ -6,6 +6,7 @@ package ast
 
 import (
 	"bytes"
+	"math/big"
 	"strings"
 
 	"../token"
@@ -15,6 +16,8 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position // position of the first character of the node
+	End() token.Position // position immediately after the node
 }
 
 // Statement is implemented by nodes representing statements
@@ -42,6 +45,22 @@ func (p *Program) TokenLiteral() string {
 	return ""
 }
 
+// Pos returns the start of the first statement
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
+// End returns the end of the last statement
+func (p *Program) End() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[len(p.Statements)-1].End()
+	}
+	return token.Position{}
+}
+
 // String is the stringer function
 func (p *Program) String() string {
 	var out bytes.Buffer
@@ -55,16 +74,31 @@ func (p *Program) String() string {
 
 // LetStatement defines an assignment
 type LetStatement struct {
-	Token token.Token // the token.LET token
+	Token token.Token // the token.LET or token.CONST token
 	Name  *Identifier
 	Value Expression
 }
 
 func (ls *LetStatement) statementNode() {}
 
+// IsConst reports whether the binding was declared with const, so it cannot
+// be reassigned
+func (ls *LetStatement) IsConst() bool { return ls.Token.Type == token.CONST }
+
 // TokenLiteral returns the token literal
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
 
+// Pos ...
+func (ls *LetStatement) Pos() token.Position { return ls.Token.Pos }
+
+// End ...
+func (ls *LetStatement) End() token.Position {
+	if ls.Value == nil && ls.Name != nil {
+		return ls.Name.End()
+	}
+	return endOf(ls.Token, ls.Value)
+}
+
 // String is the stringer
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
@@ -90,9 +124,15 @@ type ReturnStatement struct {
 
 func (rs *ReturnStatement) statementNode() {}
 
-//TokenLiteral gives the token
+// TokenLiteral gives the token
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
 
+// Pos ...
+func (rs *ReturnStatement) Pos() token.Position { return rs.Token.Pos }
+
+// End ...
+func (rs *ReturnStatement) End() token.Position { return endOf(rs.Token, rs.ReturnValue) }
+
 // String is the stringer
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
@@ -108,6 +148,150 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+// ThrowStatement raises an error
+type ThrowStatement struct {
+	Token token.Token // the 'throw' token
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode() {}
+
+// TokenLiteral gives the token
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+
+// Pos ...
+func (ts *ThrowStatement) Pos() token.Position { return ts.Token.Pos }
+
+// End ...
+func (ts *ThrowStatement) End() token.Position { return endOf(ts.Token, ts.Value) }
+
+// String is the stringer
+func (ts *ThrowStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ts.TokenLiteral() + " ")
+
+	if ts.Value != nil {
+		out.WriteString(ts.Value.String())
+	}
+
+	out.WriteString(";")
+
+	return out.String()
+}
+
+// WhileStatement runs Body for as long as Condition is truthy
+type WhileStatement struct {
+	Token     token.Token // the 'while' token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode() {}
+
+// TokenLiteral gives the token
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+
+// Pos ...
+func (ws *WhileStatement) Pos() token.Position { return ws.Token.Pos }
+
+// End ...
+func (ws *WhileStatement) End() token.Position {
+	if ws.Body != nil {
+		return ws.Body.End()
+	}
+	return endOf(ws.Token, ws.Condition)
+}
+
+// String is the stringer
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("while ")
+	out.WriteString(ws.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ws.Body.String())
+
+	return out.String()
+}
+
+// ForStatement runs Body once for each element of Iterable, bound to
+// Variable
+type ForStatement struct {
+	Token    token.Token // the 'for' token
+	Variable *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForStatement) statementNode() {}
+
+// TokenLiteral gives the token
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+
+// Pos ...
+func (fs *ForStatement) Pos() token.Position { return fs.Token.Pos }
+
+// End ...
+func (fs *ForStatement) End() token.Position {
+	if fs.Body != nil {
+		return fs.Body.End()
+	}
+	return endOf(fs.Token, fs.Iterable)
+}
+
+// String is the stringer
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	out.WriteString(fs.Variable.String())
+	out.WriteString(" in ")
+	out.WriteString(fs.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
+
+// BreakStatement leaves the innermost loop
+type BreakStatement struct {
+	Token token.Token // the 'break' token
+}
+
+func (bs *BreakStatement) statementNode() {}
+
+// TokenLiteral gives the token
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+
+// Pos ...
+func (bs *BreakStatement) Pos() token.Position { return bs.Token.Pos }
+
+// End ...
+func (bs *BreakStatement) End() token.Position { return bs.Token.End }
+
+// String is the stringer
+func (bs *BreakStatement) String() string { return bs.TokenLiteral() + ";" }
+
+// ContinueStatement skips to the next iteration of the innermost loop
+type ContinueStatement struct {
+	Token token.Token // the 'continue' token
+}
+
+func (cs *ContinueStatement) statementNode() {}
+
+// TokenLiteral gives the token
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+
+// Pos ...
+func (cs *ContinueStatement) Pos() token.Position { return cs.Token.Pos }
+
+// End ...
+func (cs *ContinueStatement) End() token.Position { return cs.Token.End }
+
+// String is the stringer
+func (cs *ContinueStatement) String() string { return cs.TokenLiteral() + ";" }
+
 // ExpressionStatement is all of the other types of statement
 type ExpressionStatement struct {
 	Token      token.Token // the first token of the expression
@@ -119,6 +303,12 @@ func (es *ExpressionStatement) statementNode() {}
 // TokenLiteral gives the token
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
 
+// Pos ...
+func (es *ExpressionStatement) Pos() token.Position { return es.Token.Pos }
+
+// End ...
+func (es *ExpressionStatement) End() token.Position { return endOf(es.Token, es.Expression) }
+
 // String is the stringer function
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
@@ -139,6 +329,12 @@ func (i *Identifier) expressionNode() {}
 // TokenLiteral returns the literal
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
 
+// Pos ...
+func (i *Identifier) Pos() token.Position { return i.Token.Pos }
+
+// End ...
+func (i *Identifier) End() token.Position { return i.Token.End }
+
 // String is the stringer function
 func (i *Identifier) String() string { return i.Value }
 
@@ -146,6 +342,7 @@ func (i *Identifier) String() string { return i.Value }
 type IntegerLiteral struct {
 	Token token.Token // the token
 	Value int64
+	Big   *big.Int // the value, when it does not fit in Value
 }
 
 func (il *IntegerLiteral) expressionNode() {}
@@ -153,9 +350,35 @@ func (il *IntegerLiteral) expressionNode() {}
 // TokenLiteral returns the token
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
 
+// Pos ...
+func (il *IntegerLiteral) Pos() token.Position { return il.Token.Pos }
+
+// End ...
+func (il *IntegerLiteral) End() token.Position { return il.Token.End }
+
 // String
 func (il *IntegerLiteral) String() string { return il.Token.Literal }
 
+// FloatLiteral is a floating point literal
+type FloatLiteral struct {
+	Token token.Token // the token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode() {}
+
+// TokenLiteral returns the token
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+
+// Pos ...
+func (fl *FloatLiteral) Pos() token.Position { return fl.Token.Pos }
+
+// End ...
+func (fl *FloatLiteral) End() token.Position { return fl.Token.End }
+
+// String
+func (fl *FloatLiteral) String() string { return fl.Token.Literal }
+
 // PrefixExpression is a prefix operator expression
 type PrefixExpression struct {
 	Token    token.Token // the prefix token, e.g. !
@@ -168,6 +391,12 @@ func (pe *PrefixExpression) expressionNode() {}
 // TokenLiteral is the token
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
 
+// Pos ...
+func (pe *PrefixExpression) Pos() token.Position { return pe.Token.Pos }
+
+// End ...
+func (pe *PrefixExpression) End() token.Position { return endOf(pe.Token, pe.Right) }
+
 // String
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
@@ -193,6 +422,17 @@ func (ie *InfixExpression) expressionNode() {}
 // TokenLiteral returns the token
 func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Literal }
 
+// Pos returns the start of the left operand
+func (ie *InfixExpression) Pos() token.Position {
+	if ie.Left != nil {
+		return ie.Left.Pos()
+	}
+	return ie.Token.Pos
+}
+
+// End ...
+func (ie *InfixExpression) End() token.Position { return endOf(ie.Token, ie.Right) }
+
 // String
 func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
@@ -217,6 +457,12 @@ func (b *Boolean) expressionNode() {}
 // TokenLiteral ...
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
 
+// Pos ...
+func (b *Boolean) Pos() token.Position { return b.Token.Pos }
+
+// End ...
+func (b *Boolean) End() token.Position { return b.Token.End }
+
 // String ...
 func (b *Boolean) String() string { return b.Token.Literal }
 
@@ -233,6 +479,20 @@ func (ie *IfExpression) expressionNode() {}
 // TokenLiteral ...
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
 
+// Pos ...
+func (ie *IfExpression) Pos() token.Position { return ie.Token.Pos }
+
+// End ...
+func (ie *IfExpression) End() token.Position {
+	if ie.Alternative != nil {
+		return ie.Alternative.End()
+	}
+	if ie.Consequence != nil {
+		return ie.Consequence.End()
+	}
+	return endOf(ie.Token, ie.Condition)
+}
+
 // String ...
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
@@ -250,10 +510,90 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+// TryExpression runs Block, handing a runtime error to Catch and running
+// Finally either way. At least one of Catch and Finally is set.
+type TryExpression struct {
+	Token     token.Token // the 'try' token
+	Block     *BlockStatement
+	Parameter *Identifier // the name the caught error is bound to
+	Catch     *BlockStatement
+	Finally   *BlockStatement
+}
+
+func (te *TryExpression) expressionNode() {}
+
+// TokenLiteral ...
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+
+// Pos ...
+func (te *TryExpression) Pos() token.Position { return te.Token.Pos }
+
+// End ...
+func (te *TryExpression) End() token.Position {
+	if te.Finally != nil {
+		return te.Finally.End()
+	}
+	if te.Catch != nil {
+		return te.Catch.End()
+	}
+	if te.Block != nil {
+		return te.Block.End()
+	}
+	return te.Token.End
+}
+
+// String ...
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try ")
+	out.WriteString(te.Block.String())
+
+	if te.Catch != nil {
+		out.WriteString(" catch (")
+		out.WriteString(te.Parameter.String())
+		out.WriteString(") ")
+		out.WriteString(te.Catch.String())
+	}
+
+	if te.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(te.Finally.String())
+	}
+
+	return out.String()
+}
+
+// AssignExpression stores Value in Target, an Identifier or an
+// IndexExpression. Operator is "=" or a compound operator such as "+=".
+type AssignExpression struct {
+	Token    token.Token // the assignment operator
+	Target   Expression
+	Operator string
+	Value    Expression
+}
+
+func (ae *AssignExpression) expressionNode() {}
+
+// TokenLiteral ...
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+
+// Pos ...
+func (ae *AssignExpression) Pos() token.Position { return ae.Target.Pos() }
+
+// End ...
+func (ae *AssignExpression) End() token.Position { return endOf(ae.Token, ae.Value) }
+
+// String ...
+func (ae *AssignExpression) String() string {
+	return ae.Target.String() + " " + ae.Operator + " " + ae.Value.String()
+}
+
 // BlockStatement is a block
 type BlockStatement struct {
 	Token      token.Token // the { token
 	Statements []Statement
+	Rbrace     token.Token // the } token
 }
 
 func (bs *BlockStatement) statementNode() {}
@@ -261,6 +601,20 @@ func (bs *BlockStatement) statementNode() {}
 // TokenLiteral ...
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
 
+// Pos ...
+func (bs *BlockStatement) Pos() token.Position { return bs.Token.Pos }
+
+// End ...
+func (bs *BlockStatement) End() token.Position {
+	if bs.Rbrace.End.IsValid() {
+		return bs.Rbrace.End
+	}
+	if len(bs.Statements) > 0 {
+		return bs.Statements[len(bs.Statements)-1].End()
+	}
+	return bs.Token.End
+}
+
 // String ...
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
@@ -275,7 +629,10 @@ func (bs *BlockStatement) String() string {
 // FunctionLiteral ...
 type FunctionLiteral struct {
 	Token      token.Token // the 'fn' token
+	Name       string      // the name it was bound to by let, if any
 	Parameters []*Identifier
+	Defaults   []Expression // default value of each parameter, nil if required
+	Rest       *Identifier  // collects extra arguments when declared as ...name
 	Body       *BlockStatement
 }
 
@@ -284,28 +641,59 @@ func (fl *FunctionLiteral) expressionNode() {}
 // TokenLiteral ...
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
 
+// Pos ...
+func (fl *FunctionLiteral) Pos() token.Position { return fl.Token.Pos }
+
+// End ...
+func (fl *FunctionLiteral) End() token.Position {
+	if fl.Body != nil {
+		return fl.Body.End()
+	}
+	return fl.Token.End
+}
+
 // String ...
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
-	params := []string{}
-	for _, p := range fl.Parameters {
-		params = append(params, p.String())
-	}
 
 	out.WriteString(fl.TokenLiteral())
 	out.WriteString("(")
-	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(FormatParameters(fl.Parameters, fl.Defaults, fl.Rest))
 	out.WriteString(") ")
 	out.WriteString(fl.Body.String())
 
 	return out.String()
 }
 
+// FormatParameters formats a parameter list as it appears in source, e.g.
+// "a, b = 1, ...rest"
+func FormatParameters(params []*Identifier, defaults []Expression, rest *Identifier) string {
+	list := []string{}
+	for i, p := range params {
+		if i < len(defaults) && defaults[i] != nil {
+			list = append(list, p.String()+" = "+defaults[i].String())
+		} else {
+			list = append(list, p.String())
+		}
+	}
+
+	if rest != nil {
+		list = append(list, "..."+rest.String())
+	}
+
+	return strings.Join(list, ", ")
+}
+
 // CallExpression is a function call
 type CallExpression struct {
 	Token     token.Token // the '(' token
 	Function  Expression  // Identifier or FunctionLiteral
 	Arguments []Expression
+	Rparen    token.Token // the ')' token
+
+	// Tail is set for a call whose result is returned as is by the
+	// enclosing function, so it can be made without growing the call stack
+	Tail bool
 }
 
 func (ce *CallExpression) expressionNode() {}
@@ -313,6 +701,22 @@ func (ce *CallExpression) expressionNode() {}
 // TokenLiteral ...
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
 
+// Pos returns the start of the function expression
+func (ce *CallExpression) Pos() token.Position {
+	if ce.Function != nil {
+		return ce.Function.Pos()
+	}
+	return ce.Token.Pos
+}
+
+// End ...
+func (ce *CallExpression) End() token.Position {
+	if ce.Rparen.End.IsValid() {
+		return ce.Rparen.End
+	}
+	return ce.Token.End
+}
+
 // String ...
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
@@ -339,14 +743,57 @@ type StringLiteral struct {
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
 func (sl *StringLiteral) String() string       { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() token.Position  { return sl.Token.Pos }
+func (sl *StringLiteral) End() token.Position  { return sl.Token.End }
+
+// InterpolatedString is a string with ${...} expressions in it, whose values
+// are converted to strings and joined with the text around them
+type InterpolatedString struct {
+	Token token.Token  // the STRING_START token
+	Parts []Expression // string literals for the text, and the interpolated expressions
+	Close token.Token  // the STRING_END token
+}
+
+func (is *InterpolatedString) expressionNode()      {}
+func (is *InterpolatedString) TokenLiteral() string { return is.Token.Literal }
+func (is *InterpolatedString) Pos() token.Position  { return is.Token.Pos }
+func (is *InterpolatedString) End() token.Position {
+	if is.Close.End.IsValid() {
+		return is.Close.End
+	}
+	return is.Token.End
+}
+func (is *InterpolatedString) String() string {
+	var out bytes.Buffer
+
+	for _, part := range is.Parts {
+		if str, ok := part.(*StringLiteral); ok {
+			out.WriteString(str.Value)
+			continue
+		}
+		out.WriteString("${")
+		out.WriteString(part.String())
+		out.WriteString("}")
+	}
+
+	return out.String()
+}
 
 type ArrayLiteral struct {
 	Token    token.Token // the '[' token
 	Elements []Expression
+	Rbracket token.Token // the ']' token
 }
 
 func (al *ArrayLiteral) expressionNode()      {}
 func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.Position  { return al.Token.Pos }
+func (al *ArrayLiteral) End() token.Position {
+	if al.Rbracket.End.IsValid() {
+		return al.Rbracket.End
+	}
+	return al.Token.End
+}
 func (al *ArrayLiteral) String() string {
 	var out bytes.Buffer
 
@@ -363,13 +810,26 @@ func (al *ArrayLiteral) String() string {
 }
 
 type IndexExpression struct {
-	Token token.Token // The [ token
-	Left  Expression
-	Index Expression
+	Token    token.Token // The [ token
+	Left     Expression
+	Index    Expression
+	Rbracket token.Token // the ] token
 }
 
 func (ie *IndexExpression) expressionNode()      {}
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() token.Position {
+	if ie.Left != nil {
+		return ie.Left.Pos()
+	}
+	return ie.Token.Pos
+}
+func (ie *IndexExpression) End() token.Position {
+	if ie.Rbracket.End.IsValid() {
+		return ie.Rbracket.End
+	}
+	return endOf(ie.Token, ie.Index)
+}
 func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
 
@@ -381,3 +841,120 @@ func (ie *IndexExpression) String() string {
 
 	return out.String()
 }
+
+// SliceExpression is left[start:end] or left[start:end:step], where any of
+// the three may be left out
+type SliceExpression struct {
+	Token    token.Token // The [ token
+	Left     Expression
+	Start    Expression  // nil when left out
+	Stop     Expression  // nil when left out
+	Step     Expression  // nil when left out
+	Rbracket token.Token // the ] token
+}
+
+func (se *SliceExpression) expressionNode()      {}
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SliceExpression) Pos() token.Position {
+	if se.Left != nil {
+		return se.Left.Pos()
+	}
+	return se.Token.Pos
+}
+func (se *SliceExpression) End() token.Position {
+	if se.Rbracket.End.IsValid() {
+		return se.Rbracket.End
+	}
+	return se.Token.End
+}
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	out.WriteString("[")
+	for i, bound := range []Expression{se.Start, se.Stop, se.Step} {
+		if i == 2 && bound == nil {
+			break
+		}
+		if i > 0 {
+			out.WriteString(":")
+		}
+		if bound != nil {
+			out.WriteString(bound.String())
+		}
+	}
+	out.WriteString("])")
+
+	return out.String()
+}
+
+// endOf returns the end of exp, falling back to the end of tok when a parse
+// error left exp unset
+func endOf(tok token.Token, exp Expression) token.Position {
+	if exp != nil {
+		return exp.End()
+	}
+	return tok.End
+}
+
+// HashLiteral is a {key: value} literal. The pairs are kept in source
+// order, the order they are evaluated in.
+type HashLiteral struct {
+	Token  token.Token // the '{' token
+	Pairs  []HashPair
+	Rbrace token.Token // the '}' token
+}
+
+// HashPair is one key: value pair of a HashLiteral
+type HashPair struct {
+	Key   Expression
+	Value Expression
+}
+
+func (hl *HashLiteral) expressionNode()      {}
+func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Pos() token.Position  { return hl.Token.Pos }
+func (hl *HashLiteral) End() token.Position {
+	if hl.Rbrace.End.IsValid() {
+		return hl.Rbrace.End
+	}
+	return hl.Token.End
+}
+func (hl *HashLiteral) String() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, pair.Key.String()+":"+pair.Value.String())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// BadStatement is a placeholder for source that failed to parse
+type BadStatement struct {
+	Token token.Token // the first token of the broken statement
+	Last  token.Token // the last token skipped while recovering
+}
+
+func (bs *BadStatement) statementNode()       {}
+func (bs *BadStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BadStatement) String() string       { return "<bad statement>" }
+func (bs *BadStatement) Pos() token.Position  { return bs.Token.Pos }
+func (bs *BadStatement) End() token.Position  { return bs.Last.End }
+
+// BadExpression is a placeholder for a token that cannot start an expression
+type BadExpression struct {
+	Token token.Token // the offending token
+}
+
+func (be *BadExpression) expressionNode()      {}
+func (be *BadExpression) TokenLiteral() string { return be.Token.Literal }
+func (be *BadExpression) String() string       { return "<bad expression>" }
+func (be *BadExpression) Pos() token.Position  { return be.Token.Pos }
+func (be *BadExpression) End() token.Position  { return be.Token.End }
@@ -0,0 +1,291 @@
+// checker/checker.go
+//
+// defines the static checks run on a program in strict mode
+
+package checker
+
+import (
+	"fmt"
+	"sort"
+
+	"../ast"
+	"../diagnostic"
+)
+
+// Codes of the diagnostics reported by Check
+const (
+	ErrUnusedBinding = "C0001" // a let or const binding is never read
+	ErrShadowed      = "C0002" // a let or const redeclares or shadows another binding
+)
+
+// kind says how a name was bound, which decides what is checked about it
+type kind int
+
+const (
+	variable  kind = iota // a loop variable or caught error, never reported
+	parameter             // reported when it shadows another binding
+	declared              // bound by let or const, also reported when unused
+)
+
+type binding struct {
+	name *ast.Identifier
+	used bool
+	kind kind
+}
+
+// scope mirrors an environment created by the evaluator
+type scope struct {
+	outer    *scope
+	bindings map[string]*binding
+	order    []*binding
+
+	// while loops being checked in this scope, whose bodies run in it
+	loops int
+
+	// function literals whose bodies are checked when the scope ends, so
+	// they see every binding made in it, like they would when called
+	functions []*ast.FunctionLiteral
+}
+
+func (s *scope) lookup(name string) (*binding, bool) {
+	for ; s != nil; s = s.outer {
+		if b, ok := s.bindings[name]; ok {
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+type checker struct {
+	scope       *scope
+	diagnostics []*diagnostic.Diagnostic
+}
+
+// Check reports the let and const bindings and the parameters of program
+// that shadow another binding, and the let and const bindings that are never
+// used. Top level bindings may be used by later programs, and names starting
+// with _ are meant to be ignored, so neither count as unused. globals are the
+// names bound at the top level before program runs, by the host or by
+// earlier programs, and are redeclared or shadowed like its own bindings.
+func Check(program *ast.Program, globals ...string) []*diagnostic.Diagnostic {
+	c := &checker{}
+
+	c.openScope()
+	for _, name := range globals {
+		b := &binding{name: &ast.Identifier{Value: name}, used: true, kind: variable}
+		c.scope.bindings[name] = b
+	}
+	for _, stmt := range program.Statements {
+		c.statement(stmt)
+	}
+	c.closeScope(false)
+
+	sort.SliceStable(c.diagnostics, func(i, j int) bool {
+		a, b := c.diagnostics[i].Pos, c.diagnostics[j].Pos
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return c.diagnostics
+}
+
+func (c *checker) openScope() {
+	c.scope = &scope{outer: c.scope, bindings: make(map[string]*binding)}
+}
+
+func (c *checker) closeScope(reportUnused bool) {
+	s := c.scope
+
+	for len(s.functions) > 0 {
+		fn := s.functions[0]
+		s.functions = s.functions[1:]
+		c.function(fn)
+	}
+
+	if reportUnused {
+		for _, b := range s.order {
+			if b.kind == declared && !b.used && b.name.Value[0] != '_' {
+				c.report(ErrUnusedBinding, b.name, "%s is declared but never used", b.name.Value)
+			}
+		}
+	}
+
+	c.scope = s.outer
+}
+
+func (c *checker) report(code string, name *ast.Identifier, format string, a ...interface{}) {
+	c.diagnostics = append(c.diagnostics, &diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Code:     code,
+		Message:  fmt.Sprintf(format, a...),
+		Pos:      name.Pos(),
+		End:      name.End(),
+	})
+}
+
+// bind adds name to the current scope
+func (c *checker) bind(name *ast.Identifier, k kind) {
+	if k != variable {
+		if _, ok := c.scope.bindings[name.Value]; ok {
+			c.report(ErrShadowed, name, "%s is already declared in this scope", name.Value)
+		} else if _, ok := c.scope.outer.lookup(name.Value); ok {
+			c.report(ErrShadowed, name, "%s shadows a binding in an enclosing scope", name.Value)
+		} else if k == declared && c.scope.loops > 0 {
+			c.report(ErrShadowed, name, "%s is redeclared by every iteration of the loop", name.Value)
+		}
+	}
+
+	b := &binding{name: name, kind: k}
+	c.scope.bindings[name.Value] = b
+	c.scope.order = append(c.scope.order, b)
+}
+
+func (c *checker) use(name *ast.Identifier) {
+	if b, ok := c.scope.lookup(name.Value); ok {
+		b.used = true
+	}
+}
+
+func (c *checker) block(block *ast.BlockStatement) {
+	if block == nil {
+		return
+	}
+	for _, stmt := range block.Statements {
+		c.statement(stmt)
+	}
+}
+
+// loopBody checks the body of a for loop, which gets a new scope holding the
+// loop variable on every iteration
+func (c *checker) loopBody(name *ast.Identifier, body *ast.BlockStatement) {
+	c.openScope()
+	c.bind(name, variable)
+	c.block(body)
+	c.closeScope(true)
+}
+
+func (c *checker) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		// a function can refer to the name it is bound to
+		if fn, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+			c.bind(stmt.Name, declared)
+			c.expression(fn)
+			return
+		}
+		c.expression(stmt.Value)
+		c.bind(stmt.Name, declared)
+
+	case *ast.ReturnStatement:
+		c.expression(stmt.ReturnValue)
+
+	case *ast.ThrowStatement:
+		c.expression(stmt.Value)
+
+	case *ast.ExpressionStatement:
+		c.expression(stmt.Expression)
+
+	case *ast.WhileStatement:
+		// the body runs in the enclosing scope, like an if block
+		c.expression(stmt.Condition)
+		c.scope.loops++
+		c.block(stmt.Body)
+		c.scope.loops--
+
+	case *ast.ForStatement:
+		c.expression(stmt.Iterable)
+		c.loopBody(stmt.Variable, stmt.Body)
+
+	case *ast.BlockStatement:
+		c.block(stmt)
+	}
+}
+
+func (c *checker) expression(exp ast.Expression) {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		c.use(exp)
+
+	case *ast.PrefixExpression:
+		c.expression(exp.Right)
+
+	case *ast.InfixExpression:
+		c.expression(exp.Left)
+		c.expression(exp.Right)
+
+	case *ast.IfExpression:
+		c.expression(exp.Condition)
+		c.block(exp.Consequence)
+		c.block(exp.Alternative)
+
+	case *ast.TryExpression:
+		c.block(exp.Block)
+		if exp.Catch != nil {
+			c.openScope()
+			c.bind(exp.Parameter, variable)
+			c.block(exp.Catch)
+			c.closeScope(true)
+		}
+		c.block(exp.Finally)
+
+	case *ast.AssignExpression:
+		// a plain assignment to a name only writes it
+		if _, ok := exp.Target.(*ast.Identifier); !ok || exp.Operator != "=" {
+			c.expression(exp.Target)
+		}
+		c.expression(exp.Value)
+
+	case *ast.FunctionLiteral:
+		c.scope.functions = append(c.scope.functions, exp)
+
+	case *ast.CallExpression:
+		c.expression(exp.Function)
+		for _, arg := range exp.Arguments {
+			c.expression(arg)
+		}
+
+	case *ast.InterpolatedString:
+		for _, part := range exp.Parts {
+			c.expression(part)
+		}
+
+	case *ast.ArrayLiteral:
+		for _, el := range exp.Elements {
+			c.expression(el)
+		}
+
+	case *ast.IndexExpression:
+		c.expression(exp.Left)
+		c.expression(exp.Index)
+
+	case *ast.SliceExpression:
+		c.expression(exp.Left)
+		for _, bound := range []ast.Expression{exp.Start, exp.Stop, exp.Step} {
+			if bound != nil {
+				c.expression(bound)
+			}
+		}
+
+	case *ast.HashLiteral:
+		for _, pair := range exp.Pairs {
+			c.expression(pair.Key)
+			c.expression(pair.Value)
+		}
+	}
+}
+
+// function checks the body of fn in a scope holding its parameters
+func (c *checker) function(fn *ast.FunctionLiteral) {
+	c.openScope()
+
+	for i, param := range fn.Parameters {
+		if i < len(fn.Defaults) && fn.Defaults[i] != nil {
+			c.expression(fn.Defaults[i])
+		}
+		c.bind(param, parameter)
+	}
+	if fn.Rest != nil {
+		c.bind(fn.Rest, parameter)
+	}
+
+	c.block(fn.Body)
+	c.closeScope(true)
+}
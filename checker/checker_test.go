@@ -0,0 +1,92 @@
+// checker/checker_test.go
+//
+// Unit tests for the strict mode checks
+
+package checker
+
+import (
+	"testing"
+
+	"../lexer"
+	"../parser"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 1; let y = x;", nil},
+		{"let x = 1; let x = 2;", []string{"1:16: error[C0002]: x is already declared in this scope"}},
+		{"const x = 1; let f = fn() { let x = 2; x };", []string{"1:33: error[C0002]: x shadows a binding in an enclosing scope"}},
+		{"let f = fn(x) { let x = 2; x };", []string{"1:21: error[C0002]: x is already declared in this scope"}},
+		{"let f = fn(x) { let y = x; 1 };", []string{"1:21: error[C0001]: y is declared but never used"}},
+		{"let f = fn() { let _y = 1; 1 };", nil},
+		{"let f = fn(x, y) { x };", nil},
+		{"let x = 1; let f = fn(x) { x }; f(2)", []string{"1:23: error[C0002]: x shadows a binding in an enclosing scope"}},
+		{"let f = fn(x, ...x) { x };", []string{"1:18: error[C0002]: x is already declared in this scope"}},
+		{"let f = fn() { let g = fn() { h() }; let h = fn() { 1 }; g() };", nil},
+		{"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } };", nil},
+		{"let f = fn() { let n = 0; n = 1 };", []string{"1:20: error[C0001]: n is declared but never used"}},
+		{"let f = fn() { let n = 0; n += 1 };", nil},
+		{"let f = fn() { let a = [1]; a[0] = 2 };", nil},
+		{"for (x in [1]) { let y = x; }", []string{"1:22: error[C0001]: y is declared but never used"}},
+		{"let i = 0; while (i < 2) { let i = 3; i }", []string{"1:32: error[C0002]: i is already declared in this scope"}},
+		{"let i = 0; while (i < 2) { let n = i; i += n + 1 }", []string{"1:32: error[C0002]: n is redeclared by every iteration of the loop"}},
+		{"while (true) { for (x in [1]) { let y = x; y }; break }", nil},
+		{"try { 1 } catch (e) { let m = e; m }", nil},
+		{`let f = fn(name) { let greeting = "hi"; "${greeting} ${name}" };`, nil},
+		{"let f = fn(a) { let n = 1; let m = 2; a[n::m] };", nil},
+		{"let f = fn() { let a = 1; let b = 2; 3 };", []string{
+			"1:20: error[C0001]: a is declared but never used",
+			"1:31: error[C0001]: b is declared but never used",
+		}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		if len(p.Diagnostics()) != 0 {
+			t.Fatalf("parser errors for %q: %v", tt.input, p.Diagnostics())
+		}
+
+		diagnostics := Check(program)
+		if len(diagnostics) != len(tt.expected) {
+			t.Errorf("wrong number of diagnostics for %q. want=%d, got=%v", tt.input, len(tt.expected), diagnostics)
+			continue
+		}
+		for i, d := range diagnostics {
+			if d.Error() != tt.expected[i] {
+				t.Errorf("wrong diagnostic for %q. want=%q, got=%q", tt.input, tt.expected[i], d.Error())
+			}
+		}
+	}
+}
+
+func TestCheckGlobals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 2;", []string{"1:5: error[C0002]: x is already declared in this scope"}},
+		{"let f = fn() { let cfg = 2; cfg };", []string{"1:20: error[C0002]: cfg shadows a binding in an enclosing scope"}},
+		{"let y = x + cfg;", nil},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+
+		diagnostics := Check(program, "x", "cfg")
+		if len(diagnostics) != len(tt.expected) {
+			t.Errorf("wrong number of diagnostics for %q. want=%d, got=%v", tt.input, len(tt.expected), diagnostics)
+			continue
+		}
+		for i, d := range diagnostics {
+			if d.Error() != tt.expected[i] {
+				t.Errorf("wrong diagnostic for %q. want=%q, got=%q", tt.input, tt.expected[i], d.Error())
+			}
+		}
+	}
+}
@@ -0,0 +1,293 @@
+// code/code.go
+//
+// defines the bytecode instruction set shared by the compiler and the vm
+
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Instructions is a sequence of encoded instructions
+type Instructions []byte
+
+// String disassembles the instructions, one per line
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
+
+// Opcode is the first byte of every instruction
+type Opcode byte
+
+// Opcodes
+const (
+	OpConstant Opcode = iota
+	OpPop
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+
+	OpTrue
+	OpFalse
+	OpNull
+
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpLessThan
+
+	OpMinus
+	OpBang
+
+	OpJumpNotTruthy
+	OpJump
+
+	OpGetGlobal
+	OpSetGlobal
+	OpGetLocal
+	OpSetLocal
+	OpGetBuiltin
+	OpGetFree
+	OpCurrentClosure
+
+	OpArray
+	OpHash
+	OpIndex
+
+	OpCall
+	OpReturnValue
+	OpReturn
+	OpClosure
+
+	// OpJumpIfSet jumps over the code computing a parameter's default when
+	// the caller passed an argument for it
+	OpJumpIfSet
+
+	// OpThrow pops a value and raises it as an error
+	OpThrow
+
+	// OpIter replaces the value on the stack with an iterator over it, and
+	// OpIterNext pops an iterator and pushes its next element, or jumps when
+	// there are none left
+	OpIter
+	OpIterNext
+
+	// OpSetIndex pops a value, an index and an array or hash, stores the
+	// value at the index and pushes it back. A non-zero operand is the opcode
+	// of a compound assignment, combining the old value with the new one.
+	OpSetIndex
+
+	// OpConcat pops its operand's number of values and pushes them joined as
+	// a string, converting the ones that are not strings like str does
+	OpConcat
+
+	// OpSlice pops a step, an end, a start and an array or string, and pushes
+	// the slice they select. A null bound is one that was left out.
+	OpSlice
+
+	// Closures capture variables in cells, which OpGetLocalCell and
+	// OpGetFreeCell push for OpClosure to collect, and OpCell makes for a
+	// value. OpSetFree pops a value into a captured variable.
+	OpGetLocalCell
+	OpGetFreeCell
+	OpCell
+	OpSetFree
+
+	// OpCloseCells detaches the cells of its second operand's number of
+	// locals, starting at its first, from the stack, so a loop body that runs
+	// again gets fresh variables
+	OpCloseCells
+
+	// OpTry installs a handler that a runtime error jumps to, with the error
+	// value pushed in place of whatever the protected code left on the stack.
+	// OpEndTry removes it again.
+	OpTry
+	OpEndTry
+
+	// OpTailCall calls a function like OpCall, in place of the function
+	// making the call, which returns whatever the callee returns
+	OpTailCall
+
+	// OpHashKey fails unless the value on the stack can be a hash key, so a
+	// hash literal rejects a key where it is, before computing its value
+	OpHashKey
+)
+
+// Definition describes an opcode for debugging and encoding
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+
+	OpAdd: {"OpAdd", []int{}},
+	OpSub: {"OpSub", []int{}},
+	OpMul: {"OpMul", []int{}},
+	OpDiv: {"OpDiv", []int{}},
+	OpMod: {"OpMod", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+	OpNull:  {"OpNull", []int{}},
+
+	OpEqual:       {"OpEqual", []int{}},
+	OpNotEqual:    {"OpNotEqual", []int{}},
+	OpGreaterThan: {"OpGreaterThan", []int{}},
+	OpLessThan:    {"OpLessThan", []int{}},
+
+	OpMinus: {"OpMinus", []int{}},
+	OpBang:  {"OpBang", []int{}},
+
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+	OpJump:          {"OpJump", []int{2}},
+
+	OpGetGlobal:      {"OpGetGlobal", []int{2}},
+	OpSetGlobal:      {"OpSetGlobal", []int{2}},
+	OpGetLocal:       {"OpGetLocal", []int{1}},
+	OpSetLocal:       {"OpSetLocal", []int{1}},
+	OpGetBuiltin:     {"OpGetBuiltin", []int{1}},
+	OpGetFree:        {"OpGetFree", []int{1}},
+	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+
+	OpArray: {"OpArray", []int{2}},
+	OpHash:  {"OpHash", []int{2}},
+	OpIndex: {"OpIndex", []int{}},
+
+	OpCall:        {"OpCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}},
+	OpClosure:     {"OpClosure", []int{2, 1}},
+
+	OpJumpIfSet: {"OpJumpIfSet", []int{1, 2}},
+	OpThrow:     {"OpThrow", []int{}},
+	OpIter:      {"OpIter", []int{}},
+	OpIterNext:  {"OpIterNext", []int{2}},
+	OpSetIndex:  {"OpSetIndex", []int{1}},
+	OpConcat:    {"OpConcat", []int{2}},
+	OpSlice:     {"OpSlice", []int{}},
+
+	OpGetLocalCell: {"OpGetLocalCell", []int{1}},
+	OpGetFreeCell:  {"OpGetFreeCell", []int{1}},
+	OpCell:         {"OpCell", []int{}},
+	OpSetFree:      {"OpSetFree", []int{1}},
+	OpCloseCells:   {"OpCloseCells", []int{1, 1}},
+
+	OpTry:    {"OpTry", []int{2}},
+	OpEndTry: {"OpEndTry", []int{}},
+
+	OpTailCall: {"OpTailCall", []int{1}},
+	OpHashKey:  {"OpHashKey", []int{}},
+}
+
+// Lookup returns the definition of op
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+// Make encodes an instruction
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// ReadOperands decodes the operands of an instruction, returning them and
+// the number of bytes read
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+
+		offset += width
+	}
+
+	return operands, offset
+}
+
+// ReadUint16 decodes a two byte operand
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+// ReadUint8 decodes a one byte operand
+func ReadUint8(ins Instructions) uint8 { return uint8(ins[0]) }
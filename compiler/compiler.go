@@ -0,0 +1,947 @@
+// compiler/compiler.go
+//
+// compiles the AST to bytecode for the vm
+
+package compiler
+
+import (
+	"fmt"
+
+	"../ast"
+	"../code"
+	"../object"
+	"../token"
+)
+
+// Bytecode is the result of a compilation
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants    []object.Object
+	GlobalNames  []string // the name of each global slot, for error messages
+	NumLocals    int      // slots for the variables of top level blocks
+	Positions    []object.Position
+}
+
+// Error is a program the compiler rejects, such as one using a name that is
+// never bound
+type Error struct {
+	Pos     token.Position
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Pos.IsValid() {
+		return e.Pos.String() + ": " + e.Message
+	}
+	return e.Message
+}
+
+func newError(pos token.Position, format string, a ...interface{}) *Error {
+	return &Error{Pos: pos, Message: fmt.Sprintf(format, a...)}
+}
+
+// EmittedInstruction records an instruction for later patching
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+// CompilationScope holds the instructions of the function being compiled
+type CompilationScope struct {
+	instructions        code.Instructions
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+	loops               []*loop // the loops being compiled, innermost last
+	positions           []object.Position
+
+	// the finally blocks of the protected code being compiled, innermost
+	// last, nil where there is none
+	tries []*ast.BlockStatement
+}
+
+// loop records the jumps of a loop being compiled
+type loop struct {
+	start  int   // where continue jumps to
+	breaks []int // break jumps, patched once the end of the loop is known
+	tries  int   // how many blocks of protected code are around the loop
+}
+
+// compoundOperators maps compound assignment operators to the opcode that
+// combines the old and new values
+var compoundOperators = map[string]code.Opcode{
+	"+=": code.OpAdd,
+	"-=": code.OpSub,
+	"*=": code.OpMul,
+	"/=": code.OpDiv,
+	"%=": code.OpMod,
+}
+
+// Compiler turns an AST into Bytecode
+type Compiler struct {
+	constants   []object.Object
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	pos token.Position // where the code being emitted comes from
+}
+
+// New creates a compiler with the builtins defined
+func New() *Compiler {
+	symbolTable := NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+
+	return NewWithState(symbolTable, []object.Object{})
+}
+
+// NewWithState creates a compiler that keeps adding to the symbol table and
+// constants of an earlier compilation, like the REPL does
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	return &Compiler{
+		constants:   constants,
+		symbolTable: s,
+		scopes:      []CompilationScope{{}},
+	}
+}
+
+// Compile compiles node and everything below it
+func (c *Compiler) Compile(node ast.Node) error {
+	pos := c.pos
+	c.pos = position(node)
+	defer func() { c.pos = pos }()
+
+	switch node := node.(type) {
+
+	// statements
+	case *ast.Program:
+		c.symbolTable.Declare(declarations(node.Statements))
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+
+		// a program that does not end in an expression has no value, so
+		// null is left where the vm looks for the last popped one
+		if n := len(node.Statements); n > 0 && !producesResult(node.Statements[n-1]) {
+			c.emit(code.OpNull)
+			c.emit(code.OpPop)
+		}
+
+	case *ast.ExpressionStatement:
+		if err := c.Compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+
+	case *ast.LetStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+
+		define := c.symbolTable.Define
+		if node.IsConst() {
+			define = c.symbolTable.DefineConst
+		}
+		symbol, err := define(node.Name.Value)
+		if err != nil {
+			return newError(node.Name.Pos(), "%s", err)
+		}
+		c.storeSymbol(symbol)
+
+	case *ast.WhileStatement:
+		start := len(c.currentInstructions())
+
+		if err := c.Compile(node.Condition); err != nil {
+			return err
+		}
+
+		// bogus offset, patched once the body is compiled
+		exitPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		if err := c.compileLoopBody(start, node.Body, exitPos); err != nil {
+			return err
+		}
+
+	case *ast.ForStatement:
+		if err := c.Compile(node.Iterable); err != nil {
+			return err
+		}
+		c.emitAt(node.Iterable.Pos(), code.OpIter)
+
+		// the iterator lives in a hidden variable, one per nesting level
+		iterator, _ := c.symbolTable.Define(fmt.Sprintf("for#%d", len(c.scopes[c.scopeIndex].loops)))
+		c.storeSymbol(iterator)
+
+		start := len(c.currentInstructions())
+		c.loadSymbol(iterator)
+		exitPos := c.emit(code.OpIterNext, 9999)
+
+		// the variable and the body get a block scope, like the new
+		// environment the evaluator makes for each element
+		c.enterBlock()
+		c.symbolTable.Declare(declarations(node.Body.Statements))
+		closePos := c.emit(code.OpCloseCells, 0, 0)
+		variable, _ := c.symbolTable.Define(node.Variable.Value)
+		c.storeSymbol(variable)
+
+		err := c.compileLoopBody(start, node.Body, exitPos)
+		first, count := c.symbolTable.LocalRange()
+		c.replaceInstruction(closePos, code.Make(code.OpCloseCells, first, count))
+		c.leaveBlock()
+		if err != nil {
+			return err
+		}
+
+		// the finished iterator is dropped, so it is neither kept alive nor
+		// left on the stack as the value of the loop
+		c.emit(code.OpNull)
+		c.storeSymbol(iterator)
+
+	case *ast.BreakStatement:
+		l := c.currentLoop()
+		if l == nil {
+			return newError(node.Pos(), "break outside of a loop")
+		}
+		if err := c.leaveTries(l.tries); err != nil {
+			return err
+		}
+		l.breaks = append(l.breaks, c.emit(code.OpJump, 9999))
+
+	case *ast.ContinueStatement:
+		l := c.currentLoop()
+		if l == nil {
+			return newError(node.Pos(), "continue outside of a loop")
+		}
+		if err := c.leaveTries(l.tries); err != nil {
+			return err
+		}
+		c.emit(code.OpJump, l.start)
+
+	case *ast.ReturnStatement:
+		if err := c.Compile(node.ReturnValue); err != nil {
+			return err
+		}
+		if err := c.leaveTries(0); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+
+	case *ast.ThrowStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
+
+	case *ast.BadStatement:
+		return newError(node.Pos(), "cannot compile statement that failed to parse")
+
+	// expressions
+	case *ast.InfixExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "+":
+			c.emit(code.OpAdd)
+		case "-":
+			c.emit(code.OpSub)
+		case "*":
+			c.emit(code.OpMul)
+		case "/":
+			c.emit(code.OpDiv)
+		case "%":
+			c.emit(code.OpMod)
+		case ">":
+			c.emit(code.OpGreaterThan)
+		case "<":
+			c.emit(code.OpLessThan)
+		case "==":
+			c.emit(code.OpEqual)
+		case "!=":
+			c.emit(code.OpNotEqual)
+		default:
+			return newError(node.Token.Pos, "unknown operator %s", node.Operator)
+		}
+
+	case *ast.PrefixExpression:
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		default:
+			return newError(node.Token.Pos, "unknown operator %s", node.Operator)
+		}
+
+	case *ast.AssignExpression:
+		return c.compileAssignment(node)
+
+	case *ast.IfExpression:
+		if err := c.Compile(node.Condition); err != nil {
+			return err
+		}
+
+		// bogus offsets, patched once the branches are compiled
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		if err := c.compileBranch(node.Consequence); err != nil {
+			return err
+		}
+
+		jumpPos := c.emit(code.OpJump, 9999)
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+		if node.Alternative == nil {
+			c.emit(code.OpNull)
+		} else if err := c.compileBranch(node.Alternative); err != nil {
+			return err
+		}
+
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.ResolvePending(node.Value)
+		if !ok {
+			return newError(node.Pos(), "identifier not found: %s", node.Value)
+		}
+		c.loadSymbol(symbol)
+
+	case *ast.IntegerLiteral:
+		var integer object.Object = &object.Integer{Value: node.Value}
+		if node.Big != nil {
+			integer = &object.BigInteger{Value: node.Big}
+		}
+		c.emit(code.OpConstant, c.addConstant(integer))
+
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
+
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(str))
+
+	case *ast.InterpolatedString:
+		for _, part := range node.Parts {
+			if err := c.Compile(part); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpConcat, len(node.Parts))
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			if err := c.Compile(el); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+
+	case *ast.HashLiteral:
+		for _, pair := range node.Pairs {
+			if err := c.Compile(pair.Key); err != nil {
+				return err
+			}
+			c.emitAt(pair.Key.Pos(), code.OpHashKey)
+			if err := c.Compile(pair.Value); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(node.Pairs)*2)
+
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+
+	case *ast.SliceExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		for _, bound := range []ast.Expression{node.Start, node.Stop, node.Step} {
+			if bound == nil {
+				c.emit(code.OpNull)
+				continue
+			}
+			if err := c.Compile(bound); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpSlice)
+
+	case *ast.FunctionLiteral:
+		return c.compileFunction(node)
+
+	case *ast.CallExpression:
+		if err := c.Compile(node.Function); err != nil {
+			return err
+		}
+		for _, a := range node.Arguments {
+			if err := c.Compile(a); err != nil {
+				return err
+			}
+		}
+		if node.Tail {
+			c.emit(code.OpTailCall, len(node.Arguments))
+		} else {
+			c.emit(code.OpCall, len(node.Arguments))
+		}
+
+	case *ast.TryExpression:
+		return c.compileTry(node)
+
+	case *ast.BadExpression:
+		return newError(node.Pos(), "cannot compile expression that failed to parse")
+	}
+
+	return nil
+}
+
+// compileBranch compiles the block of an if expression so it leaves exactly
+// one value on the stack
+func (c *Compiler) compileBranch(block *ast.BlockStatement) error {
+	if err := c.Compile(block); err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+	return nil
+}
+
+// compileTry compiles a try expression. The finally block is compiled into
+// every way out of the try and catch blocks: after them, into the handler
+// that passes an error on, and before a return, break or continue.
+func (c *Compiler) compileTry(node *ast.TryExpression) error {
+	handlerPos := c.enterTry(node.Finally)
+	err := c.compileBranch(node.Block)
+	c.leaveTry()
+	if err != nil {
+		return err
+	}
+	if err := c.compileFinally(node.Finally); err != nil {
+		return err
+	}
+	ends := []int{c.emit(code.OpJump, 9999)}
+
+	// the handlers start with the error on the stack
+	if node.Catch != nil {
+		c.changeOperand(handlerPos, len(c.currentInstructions()))
+
+		handlerPos = -1
+		if node.Finally != nil {
+			handlerPos = c.enterTry(node.Finally)
+		}
+		if err := c.compileCatch(node); err != nil {
+			return err
+		}
+		if node.Finally != nil {
+			c.leaveTry()
+			if err := c.compileFinally(node.Finally); err != nil {
+				return err
+			}
+		}
+		ends = append(ends, c.emit(code.OpJump, 9999))
+	}
+
+	// an error leaving the try expression runs the finally block before it
+	// is raised again
+	if handlerPos >= 0 {
+		c.changeOperand(handlerPos, len(c.currentInstructions()))
+		if err := c.compileFinally(node.Finally); err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
+	}
+
+	for _, pos := range ends {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+// compileCatch binds the error on the stack to the parameter of the catch
+// block, in a scope of its own, and compiles the block
+func (c *Compiler) compileCatch(node *ast.TryExpression) error {
+	c.enterBlock()
+	defer c.leaveBlock()
+
+	c.symbolTable.Declare(declarations(node.Catch.Statements))
+	closePos := c.emit(code.OpCloseCells, 0, 0)
+	parameter, _ := c.symbolTable.Define(node.Parameter.Value)
+	c.storeSymbol(parameter)
+
+	if err := c.compileBranch(node.Catch); err != nil {
+		return err
+	}
+
+	first, count := c.symbolTable.LocalRange()
+	c.replaceInstruction(closePos, code.Make(code.OpCloseCells, first, count))
+	return nil
+}
+
+// enterTry starts a block of code protected by a handler, whose bogus
+// address is patched at the returned offset
+func (c *Compiler) enterTry(finally *ast.BlockStatement) int {
+	scope := &c.scopes[c.scopeIndex]
+	scope.tries = append(scope.tries, finally)
+	return c.emit(code.OpTry, 9999)
+}
+
+func (c *Compiler) leaveTry() {
+	scope := &c.scopes[c.scopeIndex]
+	scope.tries = scope.tries[:len(scope.tries)-1]
+	c.emit(code.OpEndTry)
+}
+
+// leaveTries removes the handlers of the protected blocks being compiled,
+// down to the first n, running their finally blocks on the way out
+func (c *Compiler) leaveTries(n int) error {
+	tries := c.scopes[c.scopeIndex].tries
+	defer func() { c.scopes[c.scopeIndex].tries = tries }()
+
+	for i := len(tries) - 1; i >= n; i-- {
+		c.emit(code.OpEndTry)
+
+		// the finally block is outside of its own try
+		c.scopes[c.scopeIndex].tries = tries[:i]
+		if err := c.compileFinally(tries[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileFinally compiles a finally block, if there is one, leaving the
+// stack as it was
+func (c *Compiler) compileFinally(finally *ast.BlockStatement) error {
+	if finally == nil {
+		return nil
+	}
+	return c.Compile(finally)
+}
+
+// compileFunction compiles a function literal to a closure. Parameters take
+// the first local slots, followed by the rest parameter. A parameter with a
+// default gets a prologue that computes it unless an argument was passed.
+func (c *Compiler) compileFunction(node *ast.FunctionLiteral) error {
+	c.enterScope()
+
+	c.symbolTable.Declare(declarations(node.Body.Statements))
+	if node.Name != "" {
+		c.symbolTable.DefineFunctionName(node.Name)
+	}
+
+	for _, p := range node.Parameters {
+		c.symbolTable.Define(p.Value)
+	}
+	if node.Rest != nil {
+		c.symbolTable.Define(node.Rest.Value)
+	}
+
+	required := len(node.Parameters)
+	for i, d := range node.Defaults {
+		if d == nil {
+			continue
+		}
+		if i < required {
+			required = i
+		}
+
+		jumpPos := c.emit(code.OpJumpIfSet, i, 9999)
+		if err := c.Compile(d); err != nil {
+			return err
+		}
+		c.emit(code.OpSetLocal, i)
+		c.replaceInstruction(jumpPos, code.Make(code.OpJumpIfSet, i, len(c.currentInstructions())))
+	}
+
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.replaceLastPopWithReturn()
+	}
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.NumLocals()
+	positions := c.scopes[c.scopeIndex].positions
+	instructions := c.leaveScope()
+
+	for _, s := range freeSymbols {
+		c.loadCell(s)
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Instructions:  instructions,
+		Name:          node.Name,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+		NumRequired:   required,
+		HasRest:       node.Rest != nil,
+		Positions:     positions,
+		Literal:       node,
+	}
+	for _, s := range freeSymbols {
+		compiledFn.FreeNames = append(compiledFn.FreeNames, s.Name)
+	}
+
+	c.emit(code.OpClosure, c.addConstant(compiledFn), len(freeSymbols))
+	return nil
+}
+
+// producesResult reports whether the statement leaves the value of a program
+// that ends in it
+func producesResult(s ast.Statement) bool {
+	switch s.(type) {
+	case *ast.ExpressionStatement, *ast.ReturnStatement:
+		return true
+	}
+	return false
+}
+
+// Bytecode returns the result of the compilation so far
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants:    c.constants,
+		GlobalNames:  c.symbolTable.GlobalNames(),
+		NumLocals:    c.symbolTable.NumLocals(),
+		Positions:    c.scopes[c.scopeIndex].positions,
+	}
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	}
+}
+
+// loadCell pushes the cell holding the variable s, for a closure to capture
+func (c *Compiler) loadCell(s Symbol) {
+	switch s.Scope {
+	case LocalScope:
+		c.emit(code.OpGetLocalCell, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFreeCell, s.Index)
+	default:
+		c.loadSymbol(s)
+		c.emit(code.OpCell)
+	}
+}
+
+// compileAssignment leaves the assigned value on the stack
+func (c *Compiler) compileAssignment(node *ast.AssignExpression) error {
+	op, compound := compoundOperators[node.Operator]
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.ResolveVariable(target.Value)
+		if !ok && compound {
+			// the current value is read first, like in the evaluator
+			return newError(target.Pos(), "identifier not found: %s", target.Value)
+		}
+		if !ok || symbol.Scope == BuiltinScope {
+			return newError(target.Pos(), "cannot assign to undeclared identifier: %s", target.Value)
+		}
+		if symbol.Const {
+			return newError(target.Pos(), "cannot assign to constant: %s", target.Value)
+		}
+
+		if compound {
+			c.loadSymbol(symbol)
+		}
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		if compound {
+			c.emit(op)
+		}
+
+		pos := c.pos
+		c.pos = target.Pos()
+		c.storeSymbol(symbol)
+		c.pos = pos
+		c.loadSymbol(symbol)
+
+	case *ast.IndexExpression:
+		if err := c.Compile(target.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(target.Index); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+
+		c.emitAt(target.Token.Pos, code.OpSetIndex, int(op))
+
+	default:
+		return newError(node.Pos(), "cannot assign to %s", node.Target)
+	}
+
+	return nil
+}
+
+// storeSymbol pops the top of the stack into the variable s
+func (c *Compiler) storeSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	case FreeScope:
+		c.emit(code.OpSetFree, s.Index)
+	default:
+		c.emit(code.OpSetLocal, s.Index)
+	}
+}
+
+// compileLoopBody compiles body followed by a jump back to start, then
+// points the jump at exitPos and every break at the end of the loop
+func (c *Compiler) compileLoopBody(start int, body *ast.BlockStatement, exitPos int) error {
+	scope := &c.scopes[c.scopeIndex]
+	l := &loop{start: start, tries: len(scope.tries)}
+	scope.loops = append(scope.loops, l)
+
+	if err := c.Compile(body); err != nil {
+		return err
+	}
+	c.emit(code.OpJump, start)
+
+	// scopes may have been reallocated by functions in the body
+	scope = &c.scopes[c.scopeIndex]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+
+	end := len(c.currentInstructions())
+	c.changeOperand(exitPos, end)
+	for _, pos := range l.breaks {
+		c.changeOperand(pos, end)
+	}
+
+	return nil
+}
+
+func (c *Compiler) currentLoop() *loop {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		return nil
+	}
+	return loops[len(loops)-1]
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	c.setLastInstruction(op, pos)
+
+	return pos
+}
+
+// emitAt emits an instruction whose errors are reported at pos rather than
+// at the node being compiled
+func (c *Compiler) emitAt(pos token.Position, op code.Opcode, operands ...int) int {
+	saved := c.pos
+	c.pos = pos
+	defer func() { c.pos = saved }()
+
+	return c.emit(op, operands...)
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	scope := &c.scopes[c.scopeIndex]
+	posNewInstruction := len(scope.instructions)
+	scope.instructions = append(scope.instructions, ins...)
+
+	if n := len(scope.positions); n == 0 || scope.positions[n-1].Pos != c.pos {
+		scope.positions = append(scope.positions, object.Position{Offset: posNewInstruction, Pos: c.pos})
+	}
+	return posNewInstruction
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	scope := &c.scopes[c.scopeIndex]
+	scope.instructions = scope.instructions[:last.Position]
+	scope.lastInstruction = previous
+
+	for n := len(scope.positions); n > 0 && scope.positions[n-1].Offset >= last.Position; n-- {
+		scope.positions = scope.positions[:n-1]
+	}
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	newInstruction := code.Make(op, operand)
+
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+// position returns where errors raised by the code of node are reported,
+// which is the operator rather than the start for some expressions, like in
+// the evaluator
+func position(node ast.Node) token.Position {
+	switch node := node.(type) {
+	case *ast.InfixExpression:
+		return node.Token.Pos
+	case *ast.IndexExpression:
+		return node.Token.Pos
+	case *ast.SliceExpression:
+		return node.Token.Pos
+	case *ast.AssignExpression:
+		return node.Token.Pos
+	default:
+		return node.Pos()
+	}
+}
+
+// declarations collects the names statements bind with let in their own
+// scope, which includes the bodies of while loops and if expressions but not
+// those of for loops or functions
+func declarations(statements []ast.Statement) map[string]bool {
+	names := map[string]bool{}
+
+	var collect func(statements []ast.Statement)
+	block := func(b *ast.BlockStatement) {
+		if b != nil {
+			collect(b.Statements)
+		}
+	}
+	collect = func(statements []ast.Statement) {
+		for _, s := range statements {
+			switch s := s.(type) {
+			case *ast.LetStatement:
+				names[s.Name.Value] = true
+			case *ast.WhileStatement:
+				block(s.Body)
+			case *ast.ExpressionStatement:
+				switch e := s.Expression.(type) {
+				case *ast.IfExpression:
+					block(e.Consequence)
+					block(e.Alternative)
+				case *ast.TryExpression:
+					block(e.Block)
+					block(e.Finally)
+				}
+			}
+		}
+	}
+
+	collect(statements)
+	return names
+}
+
+// enterBlock opens the scope of a block in the function being compiled
+func (c *Compiler) enterBlock() {
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveBlock() {
+	c.symbolTable = c.symbolTable.Outer
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{})
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
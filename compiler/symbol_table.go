@@ -0,0 +1,254 @@
+// compiler/symbol_table.go
+//
+// defines the symbol table used to resolve identifiers to storage slots
+
+package compiler
+
+import "fmt"
+
+// SymbolScope says where the value of a symbol is stored
+type SymbolScope string
+
+const (
+	GlobalScope   SymbolScope = "GLOBAL"
+	LocalScope    SymbolScope = "LOCAL"
+	BuiltinScope  SymbolScope = "BUILTIN"
+	FreeScope     SymbolScope = "FREE"
+	FunctionScope SymbolScope = "FUNCTION"
+)
+
+// Symbol is a resolved identifier
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+	Const bool // declared with const, so it cannot be assigned to
+}
+
+// SymbolTable maps the names defined in one scope to their symbols
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	// set for the scope of a block, such as a loop body, which takes its
+	// slots from the function it is in
+	block bool
+
+	store          map[string]Symbol
+	numDefinitions int
+	names          []string // the name of each slot
+
+	// names bound by a let further on in this scope, which functions
+	// defined before the let may already refer to
+	pending map[string]bool
+
+	// slots of the blocks at the top level, which are locals of the main
+	// function rather than globals, so closures capture them
+	mainLocals int
+
+	FreeSymbols []Symbol
+}
+
+// NewSymbolTable creates the table for the global scope
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: make(map[string]Symbol)}
+}
+
+// NewEnclosedSymbolTable creates the table for a function nested in outer
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// NewBlockSymbolTable creates the table for a block nested in outer. Names
+// defined in it get slots of their own in the enclosing function, so they
+// do not clobber the names they shadow.
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewEnclosedSymbolTable(outer)
+	s.block = true
+	return s
+}
+
+// Define binds name in this scope. Defining a name twice reuses its slot, so
+// a `let` can shadow an earlier one without growing the frame, but a
+// constant cannot be redefined.
+func (s *SymbolTable) Define(name string) (Symbol, error) {
+	scope := LocalScope
+	if s.Outer == nil {
+		scope = GlobalScope
+	}
+
+	if symbol, ok := s.store[name]; ok && symbol.Scope == scope {
+		if symbol.Const {
+			return symbol, fmt.Errorf("cannot redeclare constant: %s", name)
+		}
+		return symbol, nil
+	}
+
+	symbol := Symbol{Name: name, Scope: scope}
+	switch fn := s.function(); {
+	case scope == GlobalScope:
+		symbol.Index = s.numDefinitions
+		s.numDefinitions++
+		s.names = append(s.names, name)
+	case fn.Outer == nil:
+		symbol.Index = fn.mainLocals
+		fn.mainLocals++
+	default:
+		symbol.Index = fn.numDefinitions
+		fn.numDefinitions++
+	}
+
+	s.store[name] = symbol
+	return symbol, nil
+}
+
+// DefineConst binds name like Define, as a constant
+func (s *SymbolTable) DefineConst(name string) (Symbol, error) {
+	symbol, err := s.Define(name)
+	if err != nil {
+		return symbol, err
+	}
+	symbol.Const = true
+	s.store[name] = symbol
+	return symbol, nil
+}
+
+// DefineBuiltin binds name to the builtin at index
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Scope: BuiltinScope, Index: index}
+	s.store[name] = symbol
+	return symbol
+}
+
+// DefineFunctionName binds the name of the function being compiled, so its
+// body can call itself
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Scope: FunctionScope, Index: 0}
+	s.store[name] = symbol
+	return symbol
+}
+
+// Resolve looks name up in this scope and the enclosing ones. Locals of an
+// enclosing function are turned into free symbols of this one.
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if ok || s.Outer == nil {
+		return symbol, ok
+	}
+
+	symbol, ok = s.Outer.Resolve(name)
+	if !ok || s.block {
+		return symbol, ok
+	}
+
+	if symbol.Scope == GlobalScope || symbol.Scope == BuiltinScope {
+		return symbol, ok
+	}
+
+	return s.defineFree(symbol), true
+}
+
+// Declare records the names a scope binds with let, before its code is
+// compiled
+func (s *SymbolTable) Declare(names map[string]bool) {
+	s.pending = names
+}
+
+// ResolvePending resolves name like Resolve. Failing that, it defines name in
+// the nearest scope of an enclosing function that declares it, so a function
+// can refer to a variable bound after it.
+func (s *SymbolTable) ResolvePending(name string) (Symbol, bool) {
+	if symbol, ok := s.Resolve(name); ok {
+		return symbol, true
+	}
+
+	for outer := s.function().Outer; outer != nil; outer = outer.Outer {
+		if outer.pending[name] {
+			outer.Define(name)
+			return s.Resolve(name)
+		}
+	}
+	return Symbol{}, false
+}
+
+// ResolveVariable resolves name like ResolvePending, except that the name of the
+// function being compiled refers to the variable the function was bound to,
+// so it can be assigned
+func (s *SymbolTable) ResolveVariable(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if !ok || symbol.Scope != FunctionScope {
+		if !ok && s.block {
+			return s.Outer.ResolveVariable(name)
+		}
+		return s.ResolvePending(name)
+	}
+
+	delete(s.store, name)
+	symbol, ok = s.ResolvePending(name)
+	if !ok {
+		s.store[name] = Symbol{Name: name, Scope: FunctionScope}
+	}
+	return symbol, ok
+}
+
+// LocalRange returns the first local slot defined in this scope and the
+// number of slots from there to the last one
+func (s *SymbolTable) LocalRange() (int, int) {
+	first, last := -1, -1
+	for _, symbol := range s.store {
+		if symbol.Scope != LocalScope {
+			continue
+		}
+		if first < 0 || symbol.Index < first {
+			first = symbol.Index
+		}
+		if symbol.Index > last {
+			last = symbol.Index
+		}
+	}
+	if first < 0 {
+		return 0, 0
+	}
+	return first, last - first + 1
+}
+
+// Global returns the table of the outermost scope
+func (s *SymbolTable) Global() *SymbolTable {
+	for s.Outer != nil {
+		s = s.Outer
+	}
+	return s
+}
+
+// GlobalNames returns the name of every global, indexed by slot
+func (s *SymbolTable) GlobalNames() []string {
+	return s.Global().names
+}
+
+// NumLocals returns the number of local slots the function of this scope
+// needs
+func (s *SymbolTable) NumLocals() int {
+	fn := s.function()
+	if fn.Outer == nil {
+		return fn.mainLocals
+	}
+	return fn.numDefinitions
+}
+
+// function returns the table of the function this scope is in, skipping
+// blocks
+func (s *SymbolTable) function() *SymbolTable {
+	for s.block {
+		s = s.Outer
+	}
+	return s
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Scope: FreeScope, Index: len(s.FreeSymbols) - 1}
+	s.store[original.Name] = symbol
+	return symbol
+}
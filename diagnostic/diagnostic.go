@@ -0,0 +1,139 @@
+// diagnostic/diagnostic.go
+//
+// defines structured diagnostics reported while processing source code
+
+package diagnostic
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"../token"
+)
+
+// Severity says how serious a diagnostic is
+type Severity int
+
+// Severities, from most to least serious
+const (
+	Error Severity = iota
+	Warning
+	Note
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	case Note:
+		return "note"
+	default:
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+}
+
+// Diagnostic is a single problem found in the source
+type Diagnostic struct {
+	Severity Severity
+	Code     string          // stable identifier, e.g. "P0001"
+	Message  string          // human readable description
+	Pos      token.Position  // start of the offending source
+	End      token.Position  // end of the offending source
+	Expected token.TokenType // the token that was expected, if any
+	Actual   token.TokenType // the token that was found, if any
+	Hint     string          // optional suggestion for fixing the problem
+}
+
+// Error formats the diagnostic on a single line, so a Diagnostic can be used
+// as a Go error
+func (d *Diagnostic) Error() string {
+	var out bytes.Buffer
+
+	if d.Pos.IsValid() || d.Pos.Filename != "" {
+		out.WriteString(d.Pos.String())
+		out.WriteString(": ")
+	}
+	out.WriteString(d.Severity.String())
+	if d.Code != "" {
+		out.WriteString("[" + d.Code + "]")
+	}
+	out.WriteString(": ")
+	out.WriteString(d.Message)
+
+	return out.String()
+}
+
+// Render writes the diagnostic followed by the offending source line with the
+// span underlined by carets, and the hint if there is one
+func Render(out io.Writer, source string, d *Diagnostic) {
+	io.WriteString(out, d.Error()+"\n")
+
+	if line, ok := sourceLine(source, d.Pos.Line); ok {
+		gutter := fmt.Sprintf("%d", d.Pos.Line)
+		blank := strings.Repeat(" ", len(gutter))
+
+		fmt.Fprintf(out, " %s | %s\n", gutter, line)
+		fmt.Fprintf(out, " %s | %s%s\n", blank, caretPadding(line, d.Pos.Column), strings.Repeat("^", caretWidth(line, d)))
+	}
+
+	if d.Hint != "" {
+		io.WriteString(out, "  hint: "+d.Hint+"\n")
+	}
+}
+
+// RenderAll renders each diagnostic in turn
+func RenderAll(out io.Writer, source string, diags []*Diagnostic) {
+	for _, d := range diags {
+		Render(out, source, d)
+	}
+}
+
+func sourceLine(source string, line int) (string, bool) {
+	if line < 1 {
+		return "", false
+	}
+
+	lines := strings.Split(source, "\n")
+	if line > len(lines) {
+		return "", false
+	}
+
+	return strings.TrimRight(lines[line-1], "\r"), true
+}
+
+// caretPadding mirrors the text before column so tabs line up with the
+// source. Columns count characters, not bytes.
+func caretPadding(line string, column int) string {
+	var out bytes.Buffer
+
+	for i, ch := range []rune(line) {
+		if i >= column-1 {
+			break
+		}
+		if ch == '\t' {
+			out.WriteByte('\t')
+		} else {
+			out.WriteByte(' ')
+		}
+	}
+
+	return out.String()
+}
+
+func caretWidth(line string, d *Diagnostic) int {
+	width := 1
+	if d.End.Line == d.Pos.Line && d.End.Column > d.Pos.Column {
+		width = d.End.Column - d.Pos.Column
+	}
+
+	if max := utf8.RuneCountInString(line) - d.Pos.Column + 1; width > max && max > 0 {
+		width = max
+	}
+
+	return width
+}
@@ -0,0 +1,78 @@
+// diagnostic/diagnostic_test.go
+//
+// unit tests for diagnostics
+
+package diagnostic
+
+import (
+	"bytes"
+	"testing"
+
+	"../token"
+)
+
+func TestRenderUnicode(t *testing.T) {
+	source := `let größe = "é" + 1;`
+	d := &Diagnostic{
+		Severity: Error,
+		Message:  "type mismatch",
+		Pos:      token.Position{Line: 1, Column: 13},
+		End:      token.Position{Line: 1, Column: 20},
+	}
+
+	var out bytes.Buffer
+	Render(&out, source, d)
+
+	expected := "1:13: error: type mismatch\n" +
+		" 1 | let größe = \"é\" + 1;\n" +
+		"   |             ^^^^^^^\n"
+
+	if out.String() != expected {
+		t.Errorf("wrong rendering.\nexpected=%q\ngot=     %q", expected, out.String())
+	}
+}
+
+func TestRender(t *testing.T) {
+	source := "let x = 1;\n\tlet y = add(x;\n"
+	d := &Diagnostic{
+		Severity: Error,
+		Code:     "P0001",
+		Message:  "expected next token to be ), got ; instead",
+		Pos:      token.Position{Filename: "test.mk", Offset: 24, Line: 2, Column: 15},
+		End:      token.Position{Filename: "test.mk", Offset: 25, Line: 2, Column: 16},
+		Hint:     `check for a missing ")"`,
+	}
+
+	var out bytes.Buffer
+	Render(&out, source, d)
+
+	expected := "test.mk:2:15: error[P0001]: expected next token to be ), got ; instead\n" +
+		" 2 | \tlet y = add(x;\n" +
+		"   | \t             ^\n" +
+		"  hint: check for a missing \")\"\n"
+
+	if out.String() != expected {
+		t.Errorf("wrong rendering.\nexpected=%q\ngot=     %q", expected, out.String())
+	}
+}
+
+func TestRenderSpan(t *testing.T) {
+	source := "let x = foobar;"
+	d := &Diagnostic{
+		Severity: Warning,
+		Message:  "unused",
+		Pos:      token.Position{Line: 1, Column: 9},
+		End:      token.Position{Line: 1, Column: 15},
+	}
+
+	var out bytes.Buffer
+	Render(&out, source, d)
+
+	expected := "1:9: warning: unused\n" +
+		" 1 | let x = foobar;\n" +
+		"   |         ^^^^^^\n"
+
+	if out.String() != expected {
+		t.Errorf("wrong rendering.\nexpected=%q\ngot=     %q", expected, out.String())
+	}
+}
@@ -5,181 +5,545 @@
 package evaluator
 
 import (
+	"context"
 	"fmt"
+	"strings"
 
 	"../ast"
 	"../object"
+	"../token"
 )
 
 var (
 	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	TRUE  = object.True
+	FALSE = object.False
+
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
 func newError(format string, a ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+	return &object.Error{Kind: object.RUNTIME_ERROR, Message: fmt.Sprintf(format, a...)}
 }
 
-// Eval evaluates an object for its literal
+// at sets where obj happened if it is an error that does not know yet
+func at(obj object.Object, pos token.Position) object.Object {
+	if errObj, ok := obj.(*object.Error); ok && !errObj.Pos.IsValid() {
+		errObj.Pos = pos
+	}
+	return obj
+}
+
+// Eval evaluates an object for its literal, with only the default limits
+// applied
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	return EvalContext(context.Background(), node, env, Limits{})
+}
+
+// eval evaluates a single node, counting it against the step budget
+func (e *evaluation) eval(node ast.Node, env *object.Environment) object.Object {
+	if err := e.budget.Step(); err != nil {
+		return at(err, node.Pos())
+	}
+
 	switch node := node.(type) {
 
 	// statements
 	case *ast.Program:
-		return evalProgram(node, env)
+		return e.evalProgram(node, env)
 
 	case *ast.FunctionLiteral:
-		params := node.Parameters
-		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		return &object.Function{
+			Name:       node.Name,
+			Parameters: node.Parameters,
+			Defaults:   node.Defaults,
+			Rest:       node.Rest,
+			Env:        env,
+			Body:       node.Body,
+		}
 
 	case *ast.LetStatement:
-		val := Eval(node.Value, env)
+		val := e.eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		if err := env.Declare(node.Name.Value, val, node.IsConst()); err != nil {
+			return at(err, node.Name.Token.Pos)
+		}
 
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return e.eval(node.Expression, env)
 
 	case *ast.BlockStatement:
-		return evalBlockStatements(node, env)
+		return e.evalBlockStatements(node, env)
+
+	case *ast.WhileStatement:
+		return e.evalWhileStatement(node, env)
+
+	case *ast.ForStatement:
+		return e.evalForStatement(node, env)
+
+	case *ast.BreakStatement:
+		return BREAK
+
+	case *ast.ContinueStatement:
+		return CONTINUE
+
+	case *ast.BadStatement:
+		return at(newError("cannot evaluate statement that failed to parse"), node.Pos())
 
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
+		val := e.eval(node.ReturnValue, env)
 		if isError(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 
+	case *ast.ThrowStatement:
+		val := e.eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return at(object.Thrown(val), node.Token.Pos)
+
 	// expressions
 	case *ast.CallExpression:
-		function := Eval(node.Function, env)
+		function := e.eval(node.Function, env)
 		if isError(function) {
 			return function
 		}
-		args := evalExpressions(node.Arguments, env)
+		args := e.evalExpressions(node.Arguments, env)
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
-		return applyFunction(function, args)
+		if fn, ok := function.(*object.Function); ok && node.Tail {
+			return &tailCall{fn: fn, args: args, pos: node.Pos()}
+		}
+		return e.applyFunction(function, args, node.Pos())
 
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
+		return at(evalIdentifier(node, env), node.Token.Pos)
 
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return e.evalIfExpression(node, env)
+
+	case *ast.TryExpression:
+		return e.evalTryExpression(node, env)
 
 	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
+		left := e.eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
-		right := Eval(node.Right, env)
+		right := e.eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalInfixExpression(node.Operator, left, right)
+		result := object.Infix(node.Operator, left, right)
+		return e.track(at(result, node.Token.Pos))
+
+	case *ast.AssignExpression:
+		return e.evalAssignExpression(node, env)
 
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
+		right := e.eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return at(evalPrefixExpression(node.Operator, right), node.Token.Pos)
+
+	case *ast.BadExpression:
+		return at(newError("cannot evaluate expression that failed to parse"), node.Pos())
 
 	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			return &object.BigInteger{Value: node.Big}
+		}
 		return &object.Integer{Value: node.Value}
 
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
 
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 
+	case *ast.InterpolatedString:
+		return e.evalInterpolatedString(node, env)
+
 	case *ast.ArrayLiteral:
-		elements := evalExpressions(node.Elements, env)
+		elements := e.evalExpressions(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
-		return &object.Array{Elements: elements}
+		return e.track(&object.Array{Elements: elements})
 
 	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
+		left := e.eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
-		index := Eval(node.Index, env)
+		index := e.eval(node.Index, env)
 		if isError(index) {
 			return index
 		}
-		return evalIndexExpression(left, index)
+		return at(evalIndexExpression(left, index, env.Strict()), node.Token.Pos)
+
+	case *ast.SliceExpression:
+		return e.evalSliceExpression(node, env)
+
+	case *ast.HashLiteral:
+		return e.evalHashLiteral(node, env)
 	}
 
 	return nil
 }
 
-func evalIndexExpression(left, index object.Object) object.Object {
+// evalInterpolatedString joins the text of a string with the values of its
+// interpolated expressions, converted to strings like str does
+func (e *evaluation) evalInterpolatedString(node *ast.InterpolatedString, env *object.Environment) object.Object {
+	var out strings.Builder
+
+	for _, part := range node.Parts {
+		val := e.eval(part, env)
+		if isError(val) {
+			return val
+		}
+		if str, ok := val.(*object.String); ok {
+			out.WriteString(str.Value)
+		} else {
+			out.WriteString(val.Inspect())
+		}
+	}
+
+	return e.track(&object.String{Value: out.String()})
+}
+
+// evalAssignExpression stores the value in a variable, where it was defined,
+// or in an array element or hash entry. It evaluates to the stored value.
+func (e *evaluation) evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		var current object.Object
+		if node.Operator != "=" {
+			current = e.eval(target, env)
+			if isError(current) {
+				return current
+			}
+		}
+
+		val := e.evalAssignedValue(node, current, env)
+		if isError(val) {
+			return val
+		}
+
+		if err := env.Assign(target.Value, val); err != nil {
+			return at(err, target.Token.Pos)
+		}
+		return val
+
+	case *ast.IndexExpression:
+		left := e.eval(target.Left, env)
+		if isError(left) {
+			return left
+		}
+		index := e.eval(target.Index, env)
+		if isError(index) {
+			return index
+		}
+
+		var current object.Object
+		if node.Operator != "=" {
+			current = at(evalIndexExpression(left, index, env.Strict()), target.Token.Pos)
+			if isError(current) {
+				return current
+			}
+		}
+
+		val := e.evalAssignedValue(node, current, env)
+		if isError(val) {
+			return val
+		}
+
+		return at(e.evalIndexAssignment(left, index, val), target.Token.Pos)
+
+	default:
+		return at(newError("cannot assign to %s", node.Target), node.Pos())
+	}
+}
+
+// evalAssignedValue evaluates the right side of an assignment, combined with
+// the current value for a compound operator such as +=
+func (e *evaluation) evalAssignedValue(node *ast.AssignExpression, current object.Object, env *object.Environment) object.Object {
+	val := e.eval(node.Value, env)
+	if isError(val) || current == nil {
+		return val
+	}
+
+	operator := strings.TrimSuffix(node.Operator, "=")
+	return e.track(at(object.Infix(operator, current, val), node.Token.Pos))
+}
+
+func (e *evaluation) evalIndexAssignment(left, index, val object.Object) object.Object {
+	switch left := left.(type) {
+	case *object.Array:
+		if index.Type() != object.INTEGER_OBJ {
+			return newError("array index must be INTEGER, got %s", index.Type())
+		}
+		i, ok := object.ElementIndex(index, len(left.Elements))
+		if !ok {
+			return newError("index out of range: %s", index.Inspect())
+		}
+		left.Elements[i] = val
+
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		hashKey := key.HashKey()
+		if _, ok := left.Pairs[hashKey]; !ok {
+			if err := e.budget.Allocate(1); err != nil {
+				return err
+			}
+		}
+		left.Pairs[hashKey] = object.HashPair{Key: index, Value: val}
+
+	default:
+		return newError("index assignment not supported: %s", left.Type())
+	}
+
+	return val
+}
+
+// evalHashLiteral evaluates the pairs in source order, so a key given twice
+// keeps its last value
+func (e *evaluation) evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	pairs := make(map[object.HashKey]object.HashPair)
+
+	for _, pair := range node.Pairs {
+		key := e.eval(pair.Key, env)
+		if isError(key) {
+			return key
+		}
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return at(newError("unusable as hash key: %s", key.Type()), pair.Key.Pos())
+		}
+
+		value := e.eval(pair.Value, env)
+		if isError(value) {
+			return value
+		}
+
+		pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	return e.track(&object.Hash{Pairs: pairs})
+}
+
+// evalIndexExpression indexes an array, string, hash or error value. Arrays
+// and strings count negative indices from the end, and give null for an
+// index out of range, or an error when strict is set.
+func evalIndexExpression(left, index object.Object, strict bool) object.Object {
 	switch {
-	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
-		return evalArrayIndexExpression(left, index)
+	case (left.Type() == object.ARRAY_OBJ || left.Type() == object.STRING_OBJ) && index.Type() == object.INTEGER_OBJ:
+		if result := object.IndexSequence(left, index, strict); result != nil {
+			return result
+		}
+		return NULL
+	case left.Type() == object.HASH_OBJ:
+		return evalHashIndexExpression(left, index)
+	case left.Type() == object.ERROR_VALUE_OBJ && index.Type() == object.STRING_OBJ:
+		if field, ok := left.(*object.ErrorValue).Field(index.(*object.String).Value); ok {
+			return field
+		}
+		return NULL
 	default:
 		return newError("index operator not supported: %s", left.Type())
 	}
 }
 
-func evalArrayIndexExpression(array, index object.Object) object.Object {
-	arrayObject := array.(*object.Array)
-	idx := index.(*object.Integer).Value
-	max := int64(len(arrayObject.Elements) - 1)
+// evalSliceExpression slices an array or string, evaluating the bounds that
+// are not left out
+func (e *evaluation) evalSliceExpression(node *ast.SliceExpression, env *object.Environment) object.Object {
+	left := e.eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
 
-	if idx < 0 || idx > max {
+	bounds := make([]object.Object, 3)
+	for i, bound := range []ast.Expression{node.Start, node.Stop, node.Step} {
+		if bound == nil {
+			continue
+		}
+		bounds[i] = e.eval(bound, env)
+		if isError(bounds[i]) {
+			return bounds[i]
+		}
+	}
+
+	result := object.Slice(left, bounds[0], bounds[1], bounds[2])
+	return e.track(at(result, node.Token.Pos))
+}
+
+func evalHashIndexExpression(hash, index object.Object) object.Object {
+	hashObject := hash.(*object.Hash)
+
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", index.Type())
+	}
+
+	pair, ok := hashObject.Pairs[key.HashKey()]
+	if !ok {
 		return NULL
 	}
 
-	return arrayObject.Elements[idx]
+	return pair.Value
+}
+
+// tailCall is a call in tail position, returned by the body of a function
+// so that applyFunction makes it in place of the one that returned it
+type tailCall struct {
+	fn   *object.Function
+	args []object.Object
+	pos  token.Position
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+func (tc *tailCall) Type() object.ObjectType { return "TAIL_CALL" }
+func (tc *tailCall) Inspect() string         { return "tail call to " + tc.fn.Describe() }
+
+// applyFunction calls fn from pos. Errors raised by the call itself are
+// placed at pos, and errors leaving a function carry the call stack.
+func (e *evaluation) applyFunction(fn object.Object, args []object.Object, pos token.Position) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
-		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
-		return unwrapReturnValue(evaluated)
+		// the arity is checked before the frame is pushed, so the trace of a
+		// bad call ends at the caller
+		if err := checkArity(fn, args); err != nil {
+			return e.traced(at(err, pos))
+		}
+		if err := e.enter(object.Frame{Function: fn.Name, Pos: pos}); err != nil {
+			return at(err, pos)
+		}
+		defer e.leave()
+
+		// calls in tail position come back as a tailCall and are made here,
+		// reusing the frame instead of nesting another
+		for {
+			extendedEnv, err := e.extendFunctionEnv(fn, args)
+			if err != nil {
+				return e.traced(err)
+			}
+			evaluated := unwrapReturnValue(e.eval(fn.Body, extendedEnv))
+
+			call, ok := evaluated.(*tailCall)
+			if !ok {
+				return e.traced(evaluated)
+			}
+			if err := checkArity(call.fn, call.args); err != nil {
+				return e.traced(at(err, call.pos))
+			}
+			fn, args, pos = call.fn, call.args, call.pos
+			e.frames[len(e.frames)-1] = object.Frame{Function: fn.Name, Pos: pos}
+		}
 
 	case *object.Builtin:
-		return fn.Fn(args...)
+		call := func(callee object.Object, args ...object.Object) object.Object {
+			return e.applyFunction(callee, args, pos)
+		}
+
+		result := fn.Call(call, e.budget, args...)
+		if result == nil {
+			return NULL
+		}
+		return e.track(at(result, pos))
 
 	default:
-		return newError("not a function: %s", fn.Type())
+		return at(newError("not a function: %s", fn.Type()), pos)
 	}
 }
 
-func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
+// checkArity makes sure args fits the parameters of fn, counting defaults
+// and a rest parameter
+func checkArity(fn *object.Function, args []object.Object) *object.Error {
+	required := fn.Required()
+	max := len(fn.Parameters)
+
+	if len(args) >= required && (len(args) <= max || fn.Rest != nil) {
+		return nil
+	}
+
+	var want string
+	switch {
+	case fn.Rest != nil:
+		want = fmt.Sprintf("at least %d", required)
+	case required == max:
+		want = fmt.Sprintf("%d", max)
+	default:
+		want = fmt.Sprintf("%d to %d", required, max)
+	}
+
+	return newError("wrong number of arguments to %s. got=%d, want=%s", fn.Describe(), len(args), want)
+}
+
+// extendFunctionEnv binds the arguments in a new scope enclosed by the
+// function's environment. Defaults are evaluated in that scope, so they can
+// refer to earlier parameters.
+func (e *evaluation) extendFunctionEnv(fn *object.Function, args []object.Object) (*object.Environment, *object.Error) {
 	env := object.NewEnclosedEnvironment(fn.Env)
 
 	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx])
+		if paramIdx < len(args) {
+			env.Set(param.Value, args[paramIdx])
+			continue
+		}
+
+		val := e.eval(fn.Defaults[paramIdx], env)
+		if errObj, ok := val.(*object.Error); ok {
+			return nil, errObj
+		}
+		env.Set(param.Value, val)
 	}
 
-	return env
+	if fn.Rest != nil {
+		rest := []object.Object{}
+		if len(args) > len(fn.Parameters) {
+			rest = append(rest, args[len(fn.Parameters):]...)
+		}
+		array := e.track(&object.Array{Elements: rest})
+		if errObj, ok := array.(*object.Error); ok {
+			return nil, errObj
+		}
+		env.Set(fn.Rest.Value, array)
+	}
+
+	return env, nil
 }
 
+// unwrapReturnValue turns the result of a function body into the value of
+// the call. A break or continue must not escape into the caller's loop.
 func unwrapReturnValue(obj object.Object) object.Object {
-	if returnValue, ok := obj.(*object.ReturnValue); ok {
-		return returnValue.Value
+	switch obj := obj.(type) {
+	case *object.ReturnValue:
+		return obj.Value
+	case *object.Break, *object.Continue:
+		return newError("%s outside of a loop", obj.Inspect())
+	default:
+		return obj
 	}
-
-	return obj
 }
 
-func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+func (e *evaluation) evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
 	var result []object.Object
 
-	for _, e := range exps {
-		evaluated := Eval(e, env)
+	for _, exp := range exps {
+		evaluated := e.eval(exp, env)
 		if isError(evaluated) {
 			return []object.Object{evaluated}
 		}
@@ -196,37 +560,135 @@ func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object
 	if builtin, ok := builtins[node.Value]; ok {
 		return builtin
 	}
-	return newError("identifier not found: " + node.Value)
+	return newError("identifier not found: %s", node.Value)
 
 }
 
-func evalBlockStatements(block *ast.BlockStatement, env *object.Environment) object.Object {
+// evalTryExpression evaluates to the value of the try block, or of the catch
+// block if a runtime error was caught. Limit and internal errors are never
+// caught, and skip the finally block too, since evaluation is being
+// abandoned. A finally block that returns or fails overrides the result.
+func (e *evaluation) evalTryExpression(te *ast.TryExpression, env *object.Environment) object.Object {
+	result := e.eval(te.Block, env)
+
+	if errObj, ok := result.(*object.Error); ok {
+		if errObj.Kind != object.RUNTIME_ERROR {
+			return errObj
+		}
+
+		if te.Catch != nil {
+			e.traced(errObj)
+
+			catchEnv := object.NewEnclosedEnvironment(env)
+			catchEnv.Set(te.Parameter.Value, &object.ErrorValue{Err: errObj})
+			result = e.eval(te.Catch, catchEnv)
+		}
+	}
+
+	if te.Finally != nil {
+		if errObj, ok := result.(*object.Error); ok && errObj.Kind != object.RUNTIME_ERROR {
+			return errObj
+		}
+
+		if finally := e.eval(te.Finally, env); interrupts(finally) {
+			return finally
+		}
+	}
+
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+func (e *evaluation) evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := e.eval(ws.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return NULL
+		}
+
+		if result, done := loopControl(e.eval(ws.Body, env)); done {
+			return result
+		}
+	}
+}
+
+// evalForStatement runs the body in a new scope for each element, so
+// closures created in the body see the element of their own iteration
+func (e *evaluation) evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
+	iterable := e.eval(fs.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+
+	elements, ok := object.Iterate(iterable)
+	if !ok {
+		return at(newError("cannot iterate over %s", iterable.Type()), fs.Iterable.Pos())
+	}
+
+	for _, element := range elements {
+		loopEnv := object.NewEnclosedEnvironment(env)
+		loopEnv.Set(fs.Variable.Value, element)
+
+		if result, done := loopControl(e.eval(fs.Body, loopEnv)); done {
+			return result
+		}
+	}
+
+	return NULL
+}
+
+// loopControl looks at the result of a loop body, reporting whether the loop
+// is over and what it evaluates to if so
+func loopControl(result object.Object) (object.Object, bool) {
+	switch result.(type) {
+	case *object.Break:
+		return NULL, true
+	case *object.ReturnValue, *object.Error:
+		return result, true
+	default:
+		return nil, false
+	}
+}
+
+// interrupts reports whether obj ends the enclosing blocks early
+func interrupts(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.ReturnValue, *object.Error, *object.Break, *object.Continue:
+		return true
+	default:
+		return false
+	}
+}
+
+func (e *evaluation) evalBlockStatements(block *ast.BlockStatement, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, statement := range block.Statements {
-		result = Eval(statement, env)
+		result = e.eval(statement, env)
 
-		if result != nil {
-			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
-				return result
-			}
+		if interrupts(result) {
+			return result
 		}
 	}
 
 	return result
 }
 
-func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(ie.Condition, env)
+func (e *evaluation) evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := e.eval(ie.Condition, env)
 	if isError(condition) {
 		return condition
 	}
 
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		return e.eval(ie.Consequence, env)
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return e.eval(ie.Alternative, env)
 	} else {
 		return NULL
 	}
@@ -244,78 +706,17 @@ func isTruthy(obj object.Object) bool {
 		return true
 	}
 }
-func evalInfixExpression(operator string, left object.Object, right object.Object) object.Object {
-	switch {
-	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
-		return evalStringInfixExpression(operator, left, right)
-	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
-		return evalIntegerInfixExpression(operator, left, right)
-	case operator == "==":
-		return nativeBoolToBooleanObject(left == right)
-	case operator == "!=":
-		return nativeBoolToBooleanObject(left != right)
-	case left.Type() != right.Type():
-		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
-	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
-	}
-}
-
-func evalStringInfixExpression(operator string, left object.Object, right object.Object) object.Object {
-	if operator != "+" {
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
-	}
-
-	leftVal := left.(*object.String).Value
-	rightVal := right.(*object.String).Value
-	return &object.String{Value: leftVal + rightVal}
-}
-
-func evalIntegerInfixExpression(operator string, left object.Object, right object.Object) object.Object {
-	leftVal := left.(*object.Integer).Value
-	rightVal := right.(*object.Integer).Value
-
-	switch operator {
-	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
-	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
-	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
-	case "/":
-		return &object.Integer{Value: leftVal / rightVal}
-	case "<":
-		return nativeBoolToBooleanObject(leftVal < rightVal)
-	case ">":
-		return nativeBoolToBooleanObject(leftVal > rightVal)
-	case "==":
-		return nativeBoolToBooleanObject(leftVal == rightVal)
-	case "!=":
-		return nativeBoolToBooleanObject(leftVal != rightVal)
-	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
-	}
-}
 func evalPrefixExpression(operator string, right object.Object) object.Object {
 	switch operator {
 	case "!":
 		return evalBangOperatorExpression(right)
 	case "-":
-		return evalMinusPrefixOperatorExpression(right)
+		return object.Negate(right)
 	default:
 		return newError("unknown operator: %s%s", operator, right.Type())
 	}
 }
 
-func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
-		return newError("unknown operator: -%s", right.Type())
-	}
-
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
-}
-
 func evalBangOperatorExpression(right object.Object) object.Object {
 	switch right {
 	case TRUE:
@@ -336,17 +737,19 @@ func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	return FALSE
 }
 
-func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+func (e *evaluation) evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, statement := range program.Statements {
-		result = Eval(statement, env)
+		result = e.eval(statement, env)
 
 		switch result := result.(type) {
 		case *object.ReturnValue:
 			return result.Value
 		case *object.Error:
 			return result
+		case *object.Break, *object.Continue:
+			return newError("%s outside of a loop", result.Inspect())
 		}
 	}
 
@@ -0,0 +1,87 @@
+// evaluator/limits.go
+//
+// definitions for bounding the resources a program may use
+
+package evaluator
+
+import (
+	"context"
+	"fmt"
+
+	"../ast"
+	"../object"
+)
+
+// Limits bounds the resources an evaluation may use
+type Limits = object.Limits
+
+// evaluation holds the state of a single call to EvalContext
+type evaluation struct {
+	budget *object.Budget
+	frames []object.Frame // the call stack, outermost first
+}
+
+// EvalContext evaluates node in env, stopping with a LIMIT_ERROR when ctx is
+// done or one of the limits is exceeded. A panic inside the evaluator or a
+// builtin is returned as an INTERNAL_ERROR rather than crashing the host.
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment, limits Limits) (result object.Object) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = newInternalError(r)
+		}
+	}()
+
+	budget, cancel := object.NewBudget(ctx, limits)
+	defer cancel()
+
+	e := &evaluation{budget: budget}
+
+	if err := budget.CheckContext(); err != nil {
+		return err
+	}
+
+	return e.eval(node, env)
+}
+
+func newInternalError(r interface{}) *object.Error {
+	return &object.Error{Kind: object.INTERNAL_ERROR, Message: fmt.Sprintf("internal error: %v", r)}
+}
+
+// enter pushes a function call onto the call stack, failing if it is nested
+// too deeply
+func (e *evaluation) enter(frame object.Frame) *object.Error {
+	if len(e.frames) >= e.budget.MaxDepth() {
+		return object.NewLimitError("call depth limit exceeded: %d", e.budget.MaxDepth())
+	}
+	e.frames = append(e.frames, frame)
+	return nil
+}
+
+func (e *evaluation) leave() {
+	e.frames = e.frames[:len(e.frames)-1]
+}
+
+// traced attaches a copy of the call stack to an error leaving a function,
+// unless a deeper call already did
+func (e *evaluation) traced(obj object.Object) object.Object {
+	errObj, ok := obj.(*object.Error)
+	if !ok || errObj.Trace != nil {
+		return obj
+	}
+
+	errObj.Trace = make([]object.Frame, len(e.frames))
+	for i, frame := range e.frames {
+		errObj.Trace[len(e.frames)-1-i] = frame
+	}
+
+	return errObj
+}
+
+// track counts the size of a newly created object against the allocation
+// limit, returning an error in its place once the limit is exceeded
+func (e *evaluation) track(obj object.Object) object.Object {
+	if err := e.budget.Track(obj); err != nil {
+		return err
+	}
+	return obj
+}
@@ -4,39 +4,181 @@
 
 package lexer
 
-import "../token"
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"../diagnostic"
+	"../token"
+)
+
+// Diagnostic codes reported by the lexer
+const (
+	ErrUnterminatedComment = "L0001" // a block comment is still open at the end of the input
+	ErrUnterminatedString  = "L0002" // a string is still open at the end of the input
+	ErrInvalidEscape       = "L0003" // a string contains an unknown or malformed escape sequence
+)
 
 // Lexer is the scanner construct
 type Lexer struct {
+	filename     string
 	input        string
 	position     int  // current position in input (points to current char)
 	readPosition int  // current reading position in input (after current char)
-	ch           byte // current char under examination
+	ch           rune // current char under examination
+	line         int  // line of the current char
+	column       int  // column of the current char, counted in chars rather than bytes
+
+	// the ${...} interpolations the current char is in, innermost last
+	interpolations []interpolation
+
+	diagnostics []*diagnostic.Diagnostic
+}
+
+// interpolation is an open ${...} in a string
+type interpolation struct {
+	open   token.Position // position of the string's opening quote
+	braces int            // number of '{' opened inside the expression and not yet closed
 }
 
 // New makes a new scanner for the input
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewFile("", input)
+}
+
+// NewFile makes a new scanner for the input, recording filename in the
+// position of every token
+func NewFile(filename, input string) *Lexer {
+	l := &Lexer{filename: filename, input: input, line: 1}
 	l.readChar()
+	l.skipShebang()
 	return l
 }
 
-// readChar reads a character
+// skipShebang skips a leading "#!" interpreter line, so scripts can be made
+// directly executable
+func (l *Lexer) skipShebang() {
+	if l.ch != '#' || l.peekChar() != '!' {
+		return
+	}
+
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+}
+
+// Diagnostics returns the problems found in the input scanned so far
+func (l *Lexer) Diagnostics() []*diagnostic.Diagnostic {
+	return l.diagnostics
+}
+
+// readChar decodes the next character. Bytes that are not valid UTF-8 are
+// read one at a time as utf8.RuneError.
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	width := 1
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
-		l.ch = l.input[l.readPosition]
+		l.ch, width = utf8.DecodeRuneInString(l.input[l.readPosition:])
 	}
 	l.position = l.readPosition
-	l.readPosition++
+	l.readPosition += width
+	l.column++
 }
 
-// NextToken scans the next token
+// pos returns the position of the current char
+func (l *Lexer) pos() token.Position {
+	offset := l.position
+	if offset > len(l.input) {
+		offset = len(l.input)
+	}
+	return token.Position{Filename: l.filename, Offset: offset, Line: l.line, Column: l.column}
+}
+
+// NextToken scans the next token, attaching the comments before it
 func (l *Lexer) NextToken() token.Token {
+	comments := l.skipComments()
+
+	tok := l.scanToken()
+	tok.Comments = comments
+	return tok
+}
+
+// skipComments skips whitespace and comments, returning the comments
+func (l *Lexer) skipComments() []token.Comment {
+	var comments []token.Comment
+
+	for {
+		l.skipWhitespace()
+
+		if l.ch != '/' || (l.peekChar() != '/' && l.peekChar() != '*') {
+			return comments
+		}
+
+		start := l.pos()
+		if l.peekChar() == '/' {
+			l.skipLineComment()
+		} else {
+			l.skipBlockComment()
+		}
+
+		end := l.pos()
+		comments = append(comments, token.Comment{
+			Text: l.input[start.Offset:end.Offset],
+			Pos:  start,
+			End:  end,
+		})
+	}
+}
+
+func (l *Lexer) skipLineComment() {
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+}
+
+// skipBlockComment skips a /* */ comment, which may contain nested block
+// comments
+func (l *Lexer) skipBlockComment() {
+	start := l.pos()
+	depth := 0
+
+	for {
+		switch {
+		case l.ch == 0:
+			l.diagnostics = append(l.diagnostics, &diagnostic.Diagnostic{
+				Severity: diagnostic.Error,
+				Code:     ErrUnterminatedComment,
+				Message:  "unterminated block comment",
+				Pos:      start,
+				End:      l.pos(),
+				Hint:     "close the comment with */",
+			})
+			return
+		case l.ch == '/' && l.peekChar() == '*':
+			depth++
+			l.readChar()
+		case l.ch == '*' && l.peekChar() == '/':
+			depth--
+			l.readChar()
+			if depth == 0 {
+				l.readChar()
+				return
+			}
+		}
+		l.readChar()
+	}
+}
+
+func (l *Lexer) scanToken() token.Token {
 	var tok token.Token
 
 	l.skipWhitespace()
+	start := l.pos()
 
 	switch l.ch {
 	case '=':
@@ -56,47 +198,75 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.BANG, l.ch)
 		}
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		tok = l.compoundToken(token.MINUS, token.MINUS_ASSIGN)
 	case '<':
 		tok = newToken(token.LT, l.ch)
 	case '>':
 		tok = newToken(token.GT, l.ch)
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		tok = l.compoundToken(token.ASTERISK, token.ASTERISK_ASSIGN)
+	case '%':
+		tok = l.compoundToken(token.PERCENT, token.PERCENT_ASSIGN)
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		tok = l.compoundToken(token.SLASH, token.SLASH_ASSIGN)
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
+	case ':':
+		tok = newToken(token.COLON, l.ch)
+	case '.':
+		if l.peekChar() == '.' && l.readPosition+1 < len(l.input) && l.input[l.readPosition+1] == '.' {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
 	case '(':
 		tok = newToken(token.LPAREN, l.ch)
 	case ')':
 		tok = newToken(token.RPAREN, l.ch)
 	case '{':
+		if n := len(l.interpolations); n > 0 {
+			l.interpolations[n-1].braces++
+		}
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
+		n := len(l.interpolations)
+		if n > 0 && l.interpolations[n-1].braces == 0 {
+			open := l.interpolations[n-1].open
+			l.interpolations = l.interpolations[:n-1]
+			tok.Type, tok.Literal = l.readQuoted(open, false)
+			break
+		}
+		if n > 0 {
+			l.interpolations[n-1].braces--
+		}
 		tok = newToken(token.RBRACE, l.ch)
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		tok = l.compoundToken(token.PLUS, token.PLUS_ASSIGN)
 	case '[':
 		tok = newToken(token.LBRACKET, l.ch)
 	case ']':
 		tok = newToken(token.RBRACKET, l.ch)
-	case '"':
-		tok.Type = token.STRING
-		tok.Literal = l.readString()
+	case '"', '`':
+		tok.Type, tok.Literal = l.readString()
 	case 0:
+		l.closeInterpolations()
 		tok.Literal = ""
 		tok.Type = token.EOF
+		tok.Pos, tok.End = start, start
+		return tok
 	default:
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Pos, tok.End = start, l.pos()
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
+			tok.Literal, tok.Type = l.readNumber()
+			tok.Pos, tok.End = start, l.pos()
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
@@ -104,37 +274,67 @@ func (l *Lexer) NextToken() token.Token {
 	}
 
 	l.readChar()
+	tok.Pos, tok.End = start, l.pos()
 	return tok
 }
 
-func (l *Lexer) readString() string {
-	position := l.position + 1
-	for {
-		l.readChar()
-		if l.ch == '"' || l.ch == 0 {
-			break
-		}
-	}
-	return l.input[position:l.position]
-}
-
-func (l *Lexer) peekChar() byte {
+func (l *Lexer) peekChar() rune {
 	if l.readPosition >= len(l.input) {
 		return 0
-	} else {
-		return l.input[l.readPosition]
 	}
+	r, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	return r
 }
 
-func (l *Lexer) readNumber() string {
+// readNumber reads an integer, or a float when a fraction or an exponent
+// follows the digits. A '.' or 'e' that is not followed by a digit is left
+// for the next token.
+func (l *Lexer) readNumber() (string, token.TokenType) {
 	position := l.position
+	tokenType := token.TokenType(token.INT)
+
+	l.readDigits()
+
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
+		l.readChar()
+		l.readDigits()
+	}
+
+	if l.ch == 'e' || l.ch == 'E' {
+		next := l.peekChar()
+		if next == '+' || next == '-' {
+			next = l.peekCharAt(2)
+		}
+		if isDigit(next) {
+			tokenType = token.FLOAT
+			l.readChar()
+			if l.ch == '+' || l.ch == '-' {
+				l.readChar()
+			}
+			l.readDigits()
+		}
+	}
+
+	return l.input[position:l.position], tokenType
+}
+
+func (l *Lexer) readDigits() {
 	for isDigit(l.ch) {
 		l.readChar()
 	}
-	return l.input[position:l.position]
 }
 
-func isDigit(ch byte) bool {
+// peekCharAt returns the byte n bytes after the current char, which is only
+// meaningful when it is compared with an ASCII char
+func (l *Lexer) peekCharAt(n int) rune {
+	if l.position+n >= len(l.input) {
+		return 0
+	}
+	return rune(l.input[l.position+n])
+}
+
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
@@ -152,10 +352,23 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[position:l.position]
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+// isLetter accepts the Unicode letters, as Go identifiers do, and '_'
+func isLetter(ch rune) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' ||
+		ch >= utf8.RuneSelf && unicode.IsLetter(ch)
+}
+
+// compoundToken returns an operator token, or its compound assignment form
+// such as += when the operator is followed by '='
+func (l *Lexer) compoundToken(op, assign token.TokenType) token.Token {
+	if l.peekChar() == '=' {
+		ch := l.ch
+		l.readChar()
+		return token.Token{Type: assign, Literal: string(ch) + string(l.ch)}
+	}
+	return newToken(op, l.ch)
 }
 
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
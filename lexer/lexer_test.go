@@ -10,6 +10,369 @@ import (
 	"../token"
 )
 
+func TestUnicode(t *testing.T) {
+	input := "let größe = \"héllo\"; λ + 1 € _x"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedColumn  int
+	}{
+		{token.LET, "let", 1},
+		{token.IDENT, "größe", 5},
+		{token.ASSIGN, "=", 11},
+		{token.STRING, "héllo", 13},
+		{token.SEMICOLON, ";", 20},
+		{token.IDENT, "λ", 22},
+		{token.PLUS, "+", 24},
+		{token.INT, "1", 26},
+		{token.ILLEGAL, "€", 28},
+		{token.IDENT, "_x", 30},
+		{token.EOF, "", 32},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+		if tok.Pos.Column != tt.expectedColumn {
+			t.Errorf("tests[%d] - wrong column for %q. expected=%d, got=%d",
+				i, tok.Literal, tt.expectedColumn, tok.Pos.Column)
+		}
+	}
+
+	l = New(`"é\q"`)
+	l.NextToken()
+	if diags := l.Diagnostics(); len(diags) != 1 || diags[0].Pos.Column != 3 || diags[0].Pos.Offset != 3 {
+		t.Errorf("wrong position for an invalid escape after a multibyte char. got=%v", diags)
+	}
+}
+
+func TestInterpolation(t *testing.T) {
+	input := `"Hi ${name}, ${ {"n": 1}["n"] } and ${"in ${x}"}!" + "${a}"`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.STRING_START, "Hi "},
+		{token.IDENT, "name"},
+		{token.STRING_PART, ", "},
+		{token.LBRACE, "{"},
+		{token.STRING, "n"},
+		{token.COLON, ":"},
+		{token.INT, "1"},
+		{token.RBRACE, "}"},
+		{token.LBRACKET, "["},
+		{token.STRING, "n"},
+		{token.RBRACKET, "]"},
+		{token.STRING_PART, " and "},
+		{token.STRING_START, "in "},
+		{token.IDENT, "x"},
+		{token.STRING_END, ""},
+		{token.STRING_END, "!"},
+		{token.PLUS, "+"},
+		{token.STRING_START, ""},
+		{token.IDENT, "a"},
+		{token.STRING_END, ""},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+	if len(l.Diagnostics()) != 0 {
+		t.Errorf("unexpected diagnostics: %v", l.Diagnostics())
+	}
+
+	l = New(`let s = "a ${b`)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+	}
+	diags := l.Diagnostics()
+	if len(diags) != 1 || diags[0].Error() != "1:9: error[L0002]: unterminated string" {
+		t.Errorf("wrong diagnostics for an open interpolation. got=%v", diags)
+	}
+}
+
+func TestStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"plain"`, "plain"},
+		{`"a\"b"`, `a"b`},
+		{`"tab\tnew\nline\\"`, "tab\tnew\nline\\"},
+		{`"\u{48}\u{e9}\u{1F600}"`, "H\u00e9\U0001F600"},
+		{"`raw \\n ${x}\nline`", "raw \\n ${x}\nline"},
+		{`"""one line"""`, "one line"},
+		{"\"\"\"\n    first\n      second\n\n    third\n    \"\"\"", "first\n  second\n\nthird"},
+		{"\"\"\"\n    keep\n  \"\"\"", "  keep"},
+		{"\"\"\"\n  say \\\"hi\\\"\\n\n  \"\"\"", "say \"hi\"\n"},
+		{`""`, ""},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != token.STRING {
+			t.Fatalf("tokentype wrong for %q. got=%q", tt.input, tok.Type)
+		}
+		if tok.Literal != tt.expected {
+			t.Errorf("literal wrong for %q. expected=%q, got=%q", tt.input, tt.expected, tok.Literal)
+		}
+		if len(l.Diagnostics()) != 0 {
+			t.Errorf("unexpected diagnostics for %q: %v", tt.input, l.Diagnostics())
+		}
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Errorf("string %q did not end at its closing quotes. next=%q", tt.input, next.Literal)
+		}
+	}
+}
+
+func TestStringErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let s = "open`, "1:9: error[L0002]: unterminated string"},
+		{"let s = `open\n", "1:9: error[L0002]: unterminated string"},
+		{`"""open""`, "1:1: error[L0002]: unterminated string"},
+		{`let s = "a\`, "1:9: error[L0002]: unterminated string"},
+		{`let s = """a\`, "1:9: error[L0002]: unterminated string"},
+		{`let s = "x ${1} a\`, "1:9: error[L0002]: unterminated string"},
+		{`"a\qb"`, "1:3: error[L0003]: unknown escape sequence: \\q"},
+		{"\"ok\n \\u{110000}\"", "2:2: error[L0003]: invalid unicode escape: \\u{110000}"},
+		{`"\u41"`, "1:2: error[L0003]: invalid unicode escape: \\u"},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		}
+
+		diags := l.Diagnostics()
+		if len(diags) != 1 {
+			t.Errorf("wrong number of diagnostics for %q. got=%v", tt.input, diags)
+			continue
+		}
+		if diags[0].Error() != tt.expected {
+			t.Errorf("wrong diagnostic for %q. expected=%q, got=%q", tt.input, tt.expected, diags[0].Error())
+		}
+	}
+}
+
+func TestAssignmentOperators(t *testing.T) {
+	input := "x = 1; x += 2; x -= 3; x *= 4; x /= 5; x %= 6; x == 7"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "x"}, {token.ASSIGN, "="}, {token.INT, "1"}, {token.SEMICOLON, ";"},
+		{token.IDENT, "x"}, {token.PLUS_ASSIGN, "+="}, {token.INT, "2"}, {token.SEMICOLON, ";"},
+		{token.IDENT, "x"}, {token.MINUS_ASSIGN, "-="}, {token.INT, "3"}, {token.SEMICOLON, ";"},
+		{token.IDENT, "x"}, {token.ASTERISK_ASSIGN, "*="}, {token.INT, "4"}, {token.SEMICOLON, ";"},
+		{token.IDENT, "x"}, {token.SLASH_ASSIGN, "/="}, {token.INT, "5"}, {token.SEMICOLON, ";"},
+		{token.IDENT, "x"}, {token.PERCENT_ASSIGN, "%="}, {token.INT, "6"}, {token.SEMICOLON, ";"},
+		{token.IDENT, "x"}, {token.EQ, "=="}, {token.INT, "7"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	input := "5 3.14 1e-9 2.5E+3 7e 1.x 0.5.5 1..."
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "5"},
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "1e-9"},
+		{token.FLOAT, "2.5E+3"},
+		{token.INT, "7"},
+		{token.IDENT, "e"},
+		{token.INT, "1"},
+		{token.ILLEGAL, "."},
+		{token.IDENT, "x"},
+		{token.FLOAT, "0.5"},
+		{token.ILLEGAL, "."},
+		{token.INT, "5"},
+		{token.INT, "1"},
+		{token.ELLIPSIS, "..."},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading
+let x = 1; // trailing
+/* block /* nested */ still */ x / 2
+/**/`
+
+	tests := []struct {
+		expectedType     token.TokenType
+		expectedComments []string
+	}{
+		{token.LET, []string{"// leading"}},
+		{token.IDENT, nil},
+		{token.ASSIGN, nil},
+		{token.INT, nil},
+		{token.SEMICOLON, nil},
+		{token.IDENT, []string{"// trailing", "/* block /* nested */ still */"}},
+		{token.SLASH, nil},
+		{token.INT, nil},
+		{token.EOF, []string{"/**/"}},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if len(tok.Comments) != len(tt.expectedComments) {
+			t.Fatalf("tests[%d] - wrong number of comments. expected=%q, got=%+v", i, tt.expectedComments, tok.Comments)
+		}
+
+		for j, text := range tt.expectedComments {
+			if tok.Comments[j].Text != text {
+				t.Errorf("tests[%d] - comment wrong. expected=%q, got=%q", i, text, tok.Comments[j].Text)
+			}
+		}
+	}
+
+	if len(l.Diagnostics()) != 0 {
+		t.Errorf("unexpected diagnostics: %v", l.Diagnostics())
+	}
+}
+
+func TestUnterminatedComment(t *testing.T) {
+	l := New("let x = 1;\n/* open /* nested */")
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+	}
+
+	diags := l.Diagnostics()
+	if len(diags) != 1 {
+		t.Fatalf("wrong number of diagnostics. got=%d", len(diags))
+	}
+
+	d := diags[0]
+	if d.Code != ErrUnterminatedComment || d.Message != "unterminated block comment" {
+		t.Errorf("wrong diagnostic. got=%s", d.Error())
+	}
+	if d.Pos.Line != 2 || d.Pos.Column != 1 {
+		t.Errorf("wrong position. got=%s", d.Pos)
+	}
+}
+
+func TestShebang(t *testing.T) {
+	input := "#!/usr/bin/env monkey\nlet x = 1;"
+
+	l := New(input)
+	tok := l.NextToken()
+
+	if tok.Type != token.LET {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.LET, tok.Type)
+	}
+
+	if tok.Pos.Line != 2 || tok.Pos.Column != 1 {
+		t.Fatalf("position wrong. expected=2:1, got=%s", tok.Pos)
+	}
+
+	l = New("let x = 1; #!")
+	for tok = l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		if tok.Type == token.ILLEGAL {
+			return
+		}
+	}
+	t.Fatalf("#! after the first line should not be skipped")
+}
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n  add(x, \"hi\");\n"
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedPos    token.Position
+		expectedEndCol int
+	}{
+		{token.LET, token.Position{Filename: "test.mk", Offset: 0, Line: 1, Column: 1}, 4},
+		{token.IDENT, token.Position{Filename: "test.mk", Offset: 4, Line: 1, Column: 5}, 6},
+		{token.ASSIGN, token.Position{Filename: "test.mk", Offset: 6, Line: 1, Column: 7}, 8},
+		{token.INT, token.Position{Filename: "test.mk", Offset: 8, Line: 1, Column: 9}, 10},
+		{token.SEMICOLON, token.Position{Filename: "test.mk", Offset: 9, Line: 1, Column: 10}, 11},
+		{token.IDENT, token.Position{Filename: "test.mk", Offset: 13, Line: 2, Column: 3}, 6},
+		{token.LPAREN, token.Position{Filename: "test.mk", Offset: 16, Line: 2, Column: 6}, 7},
+		{token.IDENT, token.Position{Filename: "test.mk", Offset: 17, Line: 2, Column: 7}, 8},
+		{token.COMMA, token.Position{Filename: "test.mk", Offset: 18, Line: 2, Column: 8}, 9},
+		{token.STRING, token.Position{Filename: "test.mk", Offset: 20, Line: 2, Column: 10}, 14},
+		{token.RPAREN, token.Position{Filename: "test.mk", Offset: 24, Line: 2, Column: 14}, 15},
+		{token.SEMICOLON, token.Position{Filename: "test.mk", Offset: 25, Line: 2, Column: 15}, 16},
+		{token.EOF, token.Position{Filename: "test.mk", Offset: 27, Line: 3, Column: 1}, 1},
+	}
+
+	l := NewFile("test.mk", input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Pos != tt.expectedPos {
+			t.Fatalf("tests[%d] - position wrong. expected=%+v, got=%+v", i, tt.expectedPos, tok.Pos)
+		}
+
+		if tok.End.Column != tt.expectedEndCol {
+			t.Fatalf("tests[%d] - end column wrong. expected=%d, got=%d", i, tt.expectedEndCol, tok.End.Column)
+		}
+	}
+}
+
 func TestNextToken(t *testing.T) {
 	input := `let five = 5;
 	let ten = 10;
@@ -19,7 +382,7 @@ func TestNextToken(t *testing.T) {
 	};
 	
 	let result = add(five, ten);
-	!-/*5;
+	!-/ *%5;
 	5 < 10 > 5;
 
 	if (5 < 10) {
@@ -33,6 +396,8 @@ func TestNextToken(t *testing.T) {
 	"foobar"
 	"foo bar"
 	[1, 2];
+	{"foo": "bar"}
+	fn(a, ...rest) {}
 	`
 
 	tests := []struct {
@@ -79,6 +444,7 @@ func TestNextToken(t *testing.T) {
 		{token.MINUS, "-"},
 		{token.SLASH, "/"},
 		{token.ASTERISK, "*"},
+		{token.PERCENT, "%"},
 		{token.INT, "5"},
 		{token.SEMICOLON, ";"},
 		{token.INT, "5"},
@@ -120,6 +486,20 @@ func TestNextToken(t *testing.T) {
 		{token.INT, "2"},
 		{token.RBRACKET, "]"},
 		{token.SEMICOLON, ";"},
+		{token.LBRACE, "{"},
+		{token.STRING, "foo"},
+		{token.COLON, ":"},
+		{token.STRING, "bar"},
+		{token.RBRACE, "}"},
+		{token.FUNCTION, "fn"},
+		{token.LPAREN, "("},
+		{token.IDENT, "a"},
+		{token.COMMA, ","},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "rest"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.RBRACE, "}"},
 		{token.EOF, ""},
 	}
 
@@ -0,0 +1,271 @@
+// lexer/string.go
+//
+// Scans string literals: "quoted" strings with escape sequences and ${...}
+// interpolations, `raw` strings and """triple quoted""" strings spanning
+// several lines
+
+package lexer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"../diagnostic"
+	"../token"
+)
+
+// readString reads a string literal starting at the current char and
+// returns its type and value, leaving the current char on the closing
+// delimiter. A quoted string is only read up to its first ${, if it has one.
+func (l *Lexer) readString() (token.TokenType, string) {
+	open := l.pos()
+
+	switch {
+	case l.ch == '`':
+		text, _, _ := l.readUntil(open, false, "`")
+		return token.STRING, text
+	case l.peekChar() == '"' && l.peekCharAt(2) == '"':
+		l.readChar()
+		l.readChar()
+		return token.STRING, l.readTripleQuoted(open)
+	default:
+		return l.readQuoted(open, true)
+	}
+}
+
+// readQuoted reads the text of the quoted string opened at open up to its
+// end or the next ${, starting after the current char, which is the opening
+// quote when first is set, or else the '}' closing an interpolation
+func (l *Lexer) readQuoted(open token.Position, first bool) (token.TokenType, string) {
+	text, start, delim := l.readUntil(open, true, `"`, "${")
+	value := l.unescapeLines(text, start)
+
+	switch {
+	case delim == "${":
+		l.interpolations = append(l.interpolations, interpolation{open: open})
+		if first {
+			return token.STRING_START, value
+		}
+		return token.STRING_PART, value
+	case first:
+		return token.STRING, value
+	default:
+		return token.STRING_END, value
+	}
+}
+
+// closeInterpolations reports the strings still open in an interpolation at
+// the end of the input
+func (l *Lexer) closeInterpolations() {
+	for _, in := range l.interpolations {
+		l.diagnostics = append(l.diagnostics, &diagnostic.Diagnostic{
+			Severity: diagnostic.Error,
+			Code:     ErrUnterminatedString,
+			Message:  "unterminated string",
+			Pos:      in.open,
+			End:      l.pos(),
+			Hint:     "close the interpolation with }",
+		})
+	}
+	l.interpolations = nil
+}
+
+// readUntil reads the text after the current char up to the first of delims,
+// returning it, where it starts and the delimiter found. A backslash escapes
+// the char after it when escapes is set. The string opened at open is
+// reported as unterminated if the input ends first, and no delimiter is
+// returned.
+func (l *Lexer) readUntil(open token.Position, escapes bool, delims ...string) (string, token.Position, string) {
+	l.readChar()
+	start := l.pos()
+	end := len(l.input)
+
+	for {
+		for _, delim := range delims {
+			if strings.HasPrefix(l.input[l.position:], delim) {
+				text := l.input[start.Offset:l.position]
+				for i := 1; i < len(delim); i++ {
+					l.readChar()
+				}
+				return text, start, delim
+			}
+		}
+
+		if l.ch == 0 {
+			l.diagnostics = append(l.diagnostics, &diagnostic.Diagnostic{
+				Severity: diagnostic.Error,
+				Code:     ErrUnterminatedString,
+				Message:  "unterminated string",
+				Pos:      open,
+				End:      l.pos(),
+				Hint:     "close the string with " + delims[0],
+			})
+			return l.input[start.Offset:end], start, ""
+		}
+
+		if escapes && l.ch == '\\' {
+			l.readChar()
+			if l.ch == 0 {
+				// the input ends in a backslash, which escapes nothing
+				end = l.position - 1
+				continue
+			}
+		}
+		l.readChar()
+	}
+}
+
+// readTripleQuoted reads a """ string. When the opening quotes end their
+// line, that line break is dropped, as is the last line if it holds nothing
+// but the closing quotes, and the indentation common to the lines and the
+// closing quotes is removed. Escape sequences are decoded like in a quoted
+// string.
+func (l *Lexer) readTripleQuoted(open token.Position) string {
+	text, start, delim := l.readUntil(open, true, `"""`)
+
+	lines := strings.Split(text, "\n")
+	if len(lines) == 1 || !isBlank(lines[0]) {
+		return l.unescapeLines(text, start)
+	}
+
+	starts := make([]token.Position, len(lines))
+	for i, line := range lines {
+		starts[i] = start
+		start.Offset += len(line) + 1
+		start.Line++
+		start.Column = 1
+	}
+	lines, starts = lines[1:], starts[1:]
+
+	indent := -1
+	if last := lines[len(lines)-1]; delim != "" && isBlank(last) {
+		indent = indentation(last)
+		lines = lines[:len(lines)-1]
+	}
+	for _, line := range lines {
+		if n := indentation(line); !isBlank(line) && (indent < 0 || n < indent) {
+			indent = n
+		}
+	}
+
+	for i, line := range lines {
+		if isBlank(line) {
+			lines[i] = ""
+			continue
+		}
+		starts[i].Offset += indent
+		starts[i].Column += indent
+		lines[i] = l.unescape(line[indent:], starts[i])
+	}
+	return strings.Join(lines, "\n")
+}
+
+func indentation(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
+
+func isBlank(line string) bool {
+	return strings.TrimLeft(line, " \t\r") == ""
+}
+
+// unescapeLines decodes the escape sequences of text, which starts at pos
+// and may span several lines
+func (l *Lexer) unescapeLines(text string, pos token.Position) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = l.unescape(line, pos)
+		pos.Offset += len(line) + 1
+		pos.Line++
+		pos.Column = 1
+	}
+	return strings.Join(lines, "\n")
+}
+
+// unescape decodes the escape sequences of a single line of a string
+// starting at pos, reporting the ones that are not valid
+func (l *Lexer) unescape(line string, pos token.Position) string {
+	if !strings.Contains(line, `\`) {
+		return line
+	}
+
+	var out strings.Builder
+
+	for i := 0; i < len(line); i++ {
+		if line[i] != '\\' {
+			out.WriteByte(line[i])
+			continue
+		}
+		if i+1 == len(line) {
+			l.invalidEscape(`\`, pos, i, "unknown escape sequence: %s at the end of a line")
+			out.WriteByte(line[i])
+			continue
+		}
+
+		start := i
+		i++
+
+		switch line[i] {
+		case 'n':
+			out.WriteByte('\n')
+		case 't':
+			out.WriteByte('\t')
+		case 'r':
+			out.WriteByte('\r')
+		case '\\', '"', '$':
+			out.WriteByte(line[i])
+		case 'u':
+			end := strings.IndexByte(line[i:], '}')
+			if i+1 < len(line) && line[i+1] == '{' && end > 0 {
+				end += i
+				if r, ok := decodeRune(line[i+2 : end]); ok {
+					out.WriteRune(r)
+					i = end
+					continue
+				}
+				i = end
+			}
+			l.invalidEscape(line[start:i+1], pos, start, "invalid unicode escape: %s")
+			out.WriteString(line[start : i+1])
+		default:
+			l.invalidEscape(line[start:i+1], pos, start, "unknown escape sequence: %s")
+			out.WriteString(line[start : i+1])
+		}
+	}
+
+	return out.String()
+}
+
+// decodeRune parses the hex digits of a \u{...} escape
+func decodeRune(digits string) (rune, bool) {
+	if len(digits) == 0 || len(digits) > 6 {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil || !utf8.ValidRune(rune(n)) {
+		return 0, false
+	}
+	return rune(n), true
+}
+
+// invalidEscape reports the escape sequence seq found offset bytes into the
+// line starting at line
+func (l *Lexer) invalidEscape(seq string, line token.Position, offset int, format string) {
+	pos := line
+	pos.Offset += offset
+	pos.Column += utf8.RuneCountInString(l.input[line.Offset:pos.Offset])
+
+	end := pos
+	end.Offset += len(seq)
+	end.Column += utf8.RuneCountInString(seq)
+
+	l.diagnostics = append(l.diagnostics, &diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Code:     ErrInvalidEscape,
+		Message:  fmt.Sprintf(format, seq),
+		Pos:      pos,
+		End:      end,
+		Hint:     `write \\ for a backslash`,
+	})
+}
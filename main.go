@@ -1,18 +1,37 @@
 // main.go
 //
-// Main implementation of the interpreter, drives the REPL
+// Main implementation of the interpreter, drives the REPL or runs a script
+// given on the command line
 
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"os"
 	"os/user"
 
+	"./monkey"
 	"./repl"
 )
 
+var (
+	useVM  = flag.Bool("vm", false, "compile scripts to bytecode and run them on the vm")
+	strict = flag.Bool("strict", false, "reject shadowed, redeclared and unused bindings, and out of range indexes")
+)
+
 func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: monkey [-vm] [-strict] [script [args...]]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() > 0 {
+		os.Exit(runFile(flag.Arg(0), flag.Args()[1:]))
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -22,3 +41,47 @@ func main() {
 	fmt.Printf("Feel free to type in commands\n")
 	repl.Start(os.Stdin, os.Stdout)
 }
+
+// runFile evaluates the script in filename with the remaining command line
+// arguments bound to `args`, and returns the process exit status
+func runFile(filename string, args []string) int {
+	engine := monkey.EngineEval
+	if *useVM {
+		engine = monkey.EngineVM
+	}
+
+	opts := []monkey.Option{monkey.WithEngine(engine), monkey.WithGlobal("args", args)}
+	if *strict {
+		opts = append(opts, monkey.WithStrict())
+	}
+
+	interp, err := monkey.New(opts...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "monkey: %s\n", err)
+		return 1
+	}
+
+	_, err = interp.RunFile(context.Background(), filename)
+	switch err := err.(type) {
+	case nil:
+		return 0
+	case *monkey.ParseError:
+		err.Render(os.Stderr)
+	case *monkey.RuntimeError:
+		location := filename
+		if err.Pos.IsValid() {
+			location = err.Pos.String()
+		}
+		fmt.Fprintf(os.Stderr, "%s: ERROR: %s%s\n", location, err.Message, err.Traceback())
+	case *monkey.LimitError:
+		location := filename
+		if err.Pos.IsValid() {
+			location = err.Pos.String()
+		}
+		fmt.Fprintf(os.Stderr, "%s: %s\n", location, err.Message)
+	default:
+		fmt.Fprintf(os.Stderr, "monkey: %s\n", err)
+	}
+
+	return 1
+}
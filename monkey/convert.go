@@ -0,0 +1,149 @@
+// monkey/convert.go
+//
+// conversions between Go values and Monkey objects
+
+package monkey
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+
+	"../evaluator"
+	"../object"
+)
+
+// Handle is an opaque reference to a Monkey value that has no Go
+// equivalent, such as a function. It can only be passed back to Monkey code.
+type Handle struct {
+	obj object.Object
+}
+
+// Type returns the Monkey type of the value, such as FUNCTION
+func (h *Handle) Type() string { return string(h.obj.Type()) }
+
+// ToObject converts a Go value to a Monkey object. It accepts nil, bools,
+// integers, *big.Int, floats, strings, slices, maps with hashable keys,
+// Funcs, Handles and values that already are objects.
+func ToObject(value interface{}) (object.Object, error) {
+	switch value := value.(type) {
+	case nil:
+		return evaluator.NULL, nil
+	case object.Object:
+		return value, nil
+	case *Handle:
+		return value.obj, nil
+	case bool:
+		if value {
+			return evaluator.TRUE, nil
+		}
+		return evaluator.FALSE, nil
+	case string:
+		return &object.String{Value: value}, nil
+	case *big.Int:
+		return object.NewBigInteger(new(big.Int).Set(value)), nil
+	case Func:
+		return wrapFunc("host function", value), nil
+	case func(args ...interface{}) (interface{}, error):
+		return wrapFunc("host function", value), nil
+	}
+
+	v := reflect.ValueOf(value)
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: v.Int()}, nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return object.NewBigInteger(new(big.Int).SetUint64(v.Uint())), nil
+
+	case reflect.Float32, reflect.Float64:
+		return &object.Float{Value: v.Float()}, nil
+
+	case reflect.Slice, reflect.Array:
+		elements := make([]object.Object, v.Len())
+		for idx := range elements {
+			el, err := ToObject(v.Index(idx).Interface())
+			if err != nil {
+				return nil, err
+			}
+			elements[idx] = el
+		}
+		return &object.Array{Elements: elements}, nil
+
+	case reflect.Map:
+		pairs := make(map[object.HashKey]object.HashPair)
+		for _, k := range v.MapKeys() {
+			key, err := ToObject(k.Interface())
+			if err != nil {
+				return nil, err
+			}
+
+			hashKey, ok := key.(object.Hashable)
+			if !ok {
+				return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+			}
+
+			val, err := ToObject(v.MapIndex(k).Interface())
+			if err != nil {
+				return nil, err
+			}
+
+			pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: val}
+		}
+		return &object.Hash{Pairs: pairs}, nil
+	}
+
+	return nil, fmt.Errorf("cannot convert %T to a Monkey value", value)
+}
+
+// FromObject converts a Monkey object to a Go value: INTEGER to int64, or to
+// *big.Int when it does not fit, FLOAT to float64, STRING to string, BOOLEAN
+// to bool, NULL to nil, ARRAY to []interface{} and HASH to
+// map[interface{}]interface{}. Other objects, such as functions, are wrapped
+// in a *Handle. An array or hash that holds itself becomes a Go value that
+// holds itself in the same way.
+func FromObject(obj object.Object) interface{} {
+	return fromObject(obj, map[object.Object]interface{}{})
+}
+
+// fromObject converts obj, with converted holding the arrays and hashes
+// converted so far
+func fromObject(obj object.Object, converted map[object.Object]interface{}) interface{} {
+	if value, ok := converted[obj]; ok {
+		return value
+	}
+
+	switch obj := obj.(type) {
+	case nil:
+		return nil
+	case *object.Null:
+		return nil
+	case *object.Integer:
+		return obj.Value
+	case *object.BigInteger:
+		return new(big.Int).Set(obj.Value)
+	case *object.Float:
+		return obj.Value
+	case *object.String:
+		return obj.Value
+	case *object.Boolean:
+		return obj.Value
+	case *object.Array:
+		values := make([]interface{}, len(obj.Elements))
+		converted[obj] = values
+		for idx, el := range obj.Elements {
+			values[idx] = fromObject(el, converted)
+		}
+		return values
+	case *object.Hash:
+		values := make(map[interface{}]interface{}, len(obj.Pairs))
+		converted[obj] = values
+		for _, pair := range obj.Pairs {
+			values[fromObject(pair.Key, converted)] = fromObject(pair.Value, converted)
+		}
+		return values
+	default:
+		return &Handle{obj: obj}
+	}
+}
@@ -0,0 +1,340 @@
+// monkey/monkey.go
+//
+// defines the embedding API, a single entry point for running Monkey code
+// from Go programs
+
+package monkey
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"../ast"
+	"../checker"
+	"../compiler"
+	"../diagnostic"
+	"../evaluator"
+	"../lexer"
+	"../object"
+	"../parser"
+	"../token"
+	"../vm"
+)
+
+// Func is a Go function that can be called from Monkey code. Arguments and
+// the result are converted with FromObject and ToObject; a non-nil error is
+// turned into a Monkey error value.
+type Func func(args ...interface{}) (interface{}, error)
+
+// Option configures an Interpreter
+type Option func(*Interpreter) error
+
+// Limits bounds the resources a single Run may use
+type Limits = object.Limits
+
+// Frame is a function call that was active when a RuntimeError happened
+type Frame = object.Frame
+
+// Engine selects how an Interpreter executes code
+type Engine int
+
+const (
+	// EngineEval walks the AST, it is the default
+	EngineEval Engine = iota
+	// EngineVM compiles to bytecode and runs it on a stack machine, which is
+	// much faster for compute heavy scripts
+	EngineVM
+)
+
+// Interpreter runs Monkey source. Bindings made by one call to Run are
+// visible to the next, like in the REPL.
+type Interpreter struct {
+	env    *object.Environment
+	stdout io.Writer
+	limits Limits
+	engine Engine
+	strict bool
+
+	// state carried between runs on the vm
+	symbolTable *compiler.SymbolTable
+	constants   []object.Object
+	globals     []object.Object
+}
+
+// New creates an interpreter with the given options applied
+func New(opts ...Option) (*Interpreter, error) {
+	i := &Interpreter{
+		env:         object.NewEnvironment(),
+		stdout:      os.Stdout,
+		symbolTable: compiler.NewSymbolTable(),
+		constants:   []object.Object{},
+		globals:     make([]object.Object, vm.GlobalsSize),
+	}
+
+	for idx, v := range object.Builtins {
+		i.symbolTable.DefineBuiltin(idx, v.Name)
+	}
+
+	i.define("puts", i.putsBuiltin())
+
+	for _, opt := range opts {
+		if err := opt(i); err != nil {
+			return nil, err
+		}
+	}
+
+	return i, nil
+}
+
+// WithFunction registers a Go host function under name
+func WithFunction(name string, fn Func) Option {
+	return func(i *Interpreter) error {
+		i.define(name, wrapFunc(name, fn))
+		return nil
+	}
+}
+
+// WithGlobal binds name to the Monkey equivalent of value
+func WithGlobal(name string, value interface{}) Option {
+	return func(i *Interpreter) error {
+		obj, err := ToObject(value)
+		if err != nil {
+			return fmt.Errorf("global %s: %s", name, err)
+		}
+		i.define(name, obj)
+		return nil
+	}
+}
+
+// WithOutput sends the output of `puts` to w instead of os.Stdout
+func WithOutput(w io.Writer) Option {
+	return func(i *Interpreter) error {
+		i.stdout = w
+		return nil
+	}
+}
+
+// WithLimits bounds the steps, call depth, time and allocations of each Run
+func WithLimits(limits Limits) Option {
+	return func(i *Interpreter) error {
+		i.limits = limits
+		return nil
+	}
+}
+
+// WithEngine selects the engine that runs the code, EngineEval by default
+func WithEngine(engine Engine) Option {
+	return func(i *Interpreter) error {
+		i.engine = engine
+		return nil
+	}
+}
+
+// WithStrict enables strict mode: a let or const that redeclares or shadows
+// another binding is an error, and so is one that is never used or indexing
+// an array or string out of range
+func WithStrict() Option {
+	return func(i *Interpreter) error {
+		i.strict = true
+		i.env.SetStrict(true)
+		return nil
+	}
+}
+
+// Run parses and evaluates source and returns the value of the last
+// statement as a Go value. Parse failures and failed strict mode checks are
+// reported as a *ParseError, exceeded limits as a *LimitError, cancellation
+// of ctx as ctx.Err() and Monkey errors as a *RuntimeError.
+func (i *Interpreter) Run(ctx context.Context, source string) (interface{}, error) {
+	return i.run(ctx, "", source)
+}
+
+// RunFile reads filename and runs it like Run, with filename recorded in
+// every reported position
+func (i *Interpreter) RunFile(ctx context.Context, filename string) (interface{}, error) {
+	source, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return i.run(ctx, filename, string(source))
+}
+
+func (i *Interpreter) run(ctx context.Context, filename, source string) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l := lexer.NewFile(filename, source)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Diagnostics()) != 0 {
+		return nil, &ParseError{Source: source, Diagnostics: p.Diagnostics()}
+	}
+
+	if i.strict {
+		if diagnostics := checker.Check(program, i.globalNames()...); len(diagnostics) != 0 {
+			return nil, &ParseError{Source: source, Diagnostics: diagnostics}
+		}
+	}
+
+	if i.engine == EngineVM {
+		return i.runVM(ctx, program)
+	}
+
+	evaluated := evaluator.EvalContext(ctx, program, i.env, i.limits)
+	if errObj, ok := evaluated.(*object.Error); ok {
+		return nil, runError(ctx, errObj)
+	}
+
+	return FromObject(evaluated), nil
+}
+
+func (i *Interpreter) runVM(ctx context.Context, program *ast.Program) (interface{}, error) {
+	comp := compiler.NewWithState(i.symbolTable, i.constants)
+	if err := comp.Compile(program); err != nil {
+		// the compiler rejects what the evaluator fails on once it runs
+		// into it, so it is reported the same way
+		if compileErr, ok := err.(*compiler.Error); ok {
+			return nil, &RuntimeError{Message: compileErr.Message, Pos: compileErr.Pos}
+		}
+		return nil, err
+	}
+
+	bytecode := comp.Bytecode()
+	i.constants = bytecode.Constants
+
+	machine := vm.NewWithGlobalsStore(bytecode, i.globals)
+	machine.SetStrict(i.strict)
+	if err := machine.RunContext(ctx, i.limits); err != nil {
+		if errObj, ok := err.(*object.Error); ok {
+			return nil, runError(ctx, errObj)
+		}
+		return nil, err
+	}
+
+	return FromObject(machine.LastPoppedStackElem()), nil
+}
+
+// globalNames returns the names bound at the top level of the engine
+func (i *Interpreter) globalNames() []string {
+	if i.engine == EngineVM {
+		return i.symbolTable.GlobalNames()
+	}
+	return i.env.Names()
+}
+
+// define binds name for both engines
+func (i *Interpreter) define(name string, obj object.Object) {
+	i.env.Set(name, obj)
+
+	symbol, _ := i.symbolTable.Define(name)
+	i.globals[symbol.Index] = obj
+}
+
+// runError turns an error object into the error Run returns for it
+func runError(ctx context.Context, errObj *object.Error) error {
+	if errObj.Kind == object.LIMIT_ERROR {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return &LimitError{Message: errObj.Message, Pos: errObj.Pos}
+	}
+	return &RuntimeError{
+		Message:  errObj.Message,
+		Pos:      errObj.Pos,
+		Trace:    errObj.Trace,
+		Internal: errObj.Kind == object.INTERNAL_ERROR,
+	}
+}
+
+func (i *Interpreter) putsBuiltin() *object.Builtin {
+	return &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			for _, arg := range args {
+				fmt.Fprintln(i.stdout, arg.Inspect())
+			}
+			return evaluator.NULL
+		},
+	}
+}
+
+func wrapFunc(name string, fn Func) *object.Builtin {
+	return &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			goArgs := make([]interface{}, len(args))
+			for idx, arg := range args {
+				goArgs[idx] = FromObject(arg)
+			}
+
+			result, err := fn(goArgs...)
+			if err != nil {
+				return &object.Error{Message: fmt.Sprintf("%s: %s", name, err)}
+			}
+
+			obj, err := ToObject(result)
+			if err != nil {
+				return &object.Error{Message: fmt.Sprintf("%s: %s", name, err)}
+			}
+			return obj
+		},
+	}
+}
+
+// ParseError is returned when the source has syntax errors, or breaks the
+// rules of strict mode
+type ParseError struct {
+	Source      string
+	Diagnostics []*diagnostic.Diagnostic
+}
+
+func (e *ParseError) Error() string {
+	msgs := make([]string, 0, len(e.Diagnostics))
+	for _, d := range e.Diagnostics {
+		msgs = append(msgs, d.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Render writes every diagnostic with the offending source line underlined
+func (e *ParseError) Render(out io.Writer) {
+	diagnostic.RenderAll(out, e.Source, e.Diagnostics)
+}
+
+// RuntimeError is returned when evaluation produces a Monkey error value
+type RuntimeError struct {
+	Message  string
+	Pos      token.Position // where the error happened, if known
+	Trace    []Frame        // the calls leading to the error, innermost first
+	Internal bool           // set when the interpreter failed rather than the script
+}
+
+// Traceback renders Trace with one indented line per frame
+func (e *RuntimeError) Traceback() string {
+	return object.FormatTrace(e.Trace)
+}
+
+func (e *RuntimeError) Error() string {
+	if e.Pos.IsValid() {
+		return e.Pos.String() + ": " + e.Message
+	}
+	return e.Message
+}
+
+// LimitError is returned when a run exceeds one of its Limits
+type LimitError struct {
+	Message string
+	Pos     token.Position // where the run stopped, such as the call too deep to make, if known
+}
+
+func (e *LimitError) Error() string {
+	if e.Pos.IsValid() {
+		return e.Pos.String() + ": " + e.Message
+	}
+	return e.Message
+}
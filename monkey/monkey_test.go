@@ -0,0 +1,447 @@
+// monkey/monkey_test.go
+//
+// unit tests for the embedding API
+
+package monkey
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWithStrict(t *testing.T) {
+	ctx := context.Background()
+
+	for _, engine := range []Engine{EngineEval, EngineVM} {
+		interp, err := New(WithStrict(), WithEngine(engine))
+		if err != nil {
+			t.Fatalf("New() failed: %s", err)
+		}
+
+		_, err = interp.Run(ctx, "let f = fn(x) { let y = x * 2; x };")
+		parseErr, ok := err.(*ParseError)
+		if !ok {
+			t.Fatalf("error is not *ParseError. got=%T (%v)", err, err)
+		}
+		if parseErr.Error() != "1:21: error[C0001]: y is declared but never used" {
+			t.Errorf("wrong error. got=%q", parseErr.Error())
+		}
+
+		result, err := interp.Run(ctx, "let x = 1; let f = fn(n) { let y = n * 2; y }; f(x)")
+		if err != nil {
+			t.Fatalf("Run failed: %s", err)
+		}
+		if result != int64(2) {
+			t.Errorf("wrong result. got=%#v", result)
+		}
+
+		_, err = interp.Run(ctx, "[1, 2, 3][3]")
+		if rtErr, ok := err.(*RuntimeError); !ok || rtErr.Message != "index out of range: 3" {
+			t.Errorf("wrong error for an index out of range. got=%T (%v)", err, err)
+		}
+	}
+
+	// bindings made before the run, by the host or by earlier runs, are
+	// checked like the run's own
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 2;", "1:5: error[C0002]: x is already declared in this scope"},
+		{"let f = fn() { let cfg = 2; cfg }; f()", "1:20: error[C0002]: cfg shadows a binding in an enclosing scope"},
+		{"let puts = 3;", "1:5: error[C0002]: puts is already declared in this scope"},
+		{"let g = fn(x) { x }; g(1)", "1:12: error[C0002]: x shadows a binding in an enclosing scope"},
+	}
+
+	for _, tt := range tests {
+		for _, engine := range []Engine{EngineEval, EngineVM} {
+			interp, _ := New(WithStrict(), WithEngine(engine), WithGlobal("cfg", 1))
+			if _, err := interp.Run(ctx, "let x = 1;"); err != nil {
+				t.Fatalf("Run failed: %s", err)
+			}
+
+			_, err := interp.Run(ctx, tt.input)
+			parseErr, ok := err.(*ParseError)
+			if !ok {
+				t.Errorf("engine %d: error for %q is not *ParseError. got=%T (%v)", engine, tt.input, err, err)
+				continue
+			}
+			if parseErr.Error() != tt.expected {
+				t.Errorf("engine %d: wrong error for %q. expected=%q, got=%q", engine, tt.input, tt.expected, parseErr.Error())
+			}
+		}
+	}
+}
+
+func TestEngineVM(t *testing.T) {
+	var out bytes.Buffer
+
+	interp, err := New(
+		WithEngine(EngineVM),
+		WithGlobal("base", 10),
+		WithFunction("double", func(args ...interface{}) (interface{}, error) {
+			return args[0].(int64) * 2, nil
+		}),
+		WithOutput(&out),
+	)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+
+	ctx := context.Background()
+	if _, err := interp.Run(ctx, "let add = fn(a, b = base) { a + b };"); err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+
+	result, err := interp.Run(ctx, `puts("hi"); [add(1), double(add(1, 2))]`)
+	if err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+	if !reflect.DeepEqual(result, []interface{}{int64(11), int64(6)}) {
+		t.Errorf("wrong result. got=%#v", result)
+	}
+	if out.String() != "hi\n" {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+
+	_, err = interp.Run(ctx, "add()")
+	rtErr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("error is not *RuntimeError. got=%T (%v)", err, err)
+	}
+	if rtErr.Message != "wrong number of arguments to `add`. got=0, want=1 to 2" {
+		t.Errorf("wrong message. got=%q", rtErr.Message)
+	}
+
+	interp, _ = New(WithEngine(EngineVM), WithLimits(Limits{MaxSteps: 500}))
+	_, err = interp.Run(ctx, "let loop = fn(n) { loop(n + 1) }; loop(0)")
+	if _, ok := err.(*LimitError); !ok {
+		t.Errorf("error is not *LimitError. got=%T (%v)", err, err)
+	}
+}
+
+func TestEngineParity(t *testing.T) {
+	tests := []struct {
+		input    string
+		strict   bool
+		expected interface{}
+		err      string
+	}{
+		{"2; let x = 5", false, nil, ""},
+		{"1; while (false) {}", false, nil, ""},
+		{"let f = fn() { 9 }; f(); const q = 1", false, nil, ""},
+		{"let x = 1", true, nil, ""},
+		{"let x = 1; x = 2", false, int64(2), ""},
+		{"if (true) { let y = 1 }", false, nil, ""},
+		{"return 4; 5", false, int64(4), ""},
+		{"3; for (i in [1]) { i }", false, nil, ""},
+		{"3; for (i in [1, 2]) { break }", false, nil, ""},
+		{"let f = fn() { for (i in [1]) { i } }; f()", false, nil, ""},
+		{`{"a": 1, "a": 2}["a"]`, false, int64(2), ""},
+		{`let s = ""; let f = fn(k) { s += k; k }; {f("a"): f("b"), f("c"): f("d")}; s`, false, "abcd", ""},
+		{"let h = {[1]: 2}", false, nil, "1:10: unusable as hash key: ARRAY"},
+		{"let n = 0; let f = fn() { n = 1 }; try { {[1]: f()} } catch (e) { n }", false, int64(0), ""},
+		{"str(fn(a, b = 1) { a + b })", false, "fn(a, b = 1) {\n(a + b)\n}", ""},
+		{"let add = fn(a, ...rest) { a }; \"${add}\"", false, "fn(a, ...rest) {\na\n}", ""},
+	}
+
+	for _, tt := range tests {
+		for _, engine := range []Engine{EngineEval, EngineVM} {
+			options := []Option{WithEngine(engine)}
+			if tt.strict {
+				options = append(options, WithStrict())
+			}
+			interp, _ := New(options...)
+
+			result, err := interp.Run(context.Background(), tt.input)
+			if errText := fmt.Sprint(err); err != nil && errText != tt.err || err == nil && tt.err != "" {
+				t.Errorf("engine %d: wrong error for %q. expected=%q, got=%q", engine, tt.input, tt.err, errText)
+				continue
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("engine %d: wrong result for %q. expected=%#v, got=%#v", engine, tt.input, tt.expected, result)
+			}
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1 + 2", int64(3)},
+		{"1.5 * 2", 3.0},
+		{"9223372036854775807 + 1", new(big.Int).Lsh(big.NewInt(1), 63)},
+		{`"a" + "b"`, "ab"},
+		{"1 < 2", true},
+		{"if (false) { 1 }", nil},
+		{"[1, [2, true]]", []interface{}{int64(1), []interface{}{int64(2), true}}},
+		{`{"a": 1, 2: "b"}`, map[interface{}]interface{}{"a": int64(1), int64(2): "b"}},
+	}
+
+	for _, tt := range tests {
+		interp, err := New()
+		if err != nil {
+			t.Fatalf("New() failed: %s", err)
+		}
+
+		result, err := interp.Run(context.Background(), tt.input)
+		if err != nil {
+			t.Errorf("Run(%q) failed: %s", tt.input, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("Run(%q) wrong result. expected=%#v, got=%#v", tt.input, tt.expected, result)
+		}
+	}
+}
+
+func TestRunSelfReference(t *testing.T) {
+	for _, engine := range []Engine{EngineEval, EngineVM} {
+		interp, _ := New(WithEngine(engine))
+
+		result, err := interp.Run(context.Background(), "let a = [1, 2]; a[0] = a; a")
+		if err != nil {
+			t.Fatalf("engine %d: Run failed: %s", engine, err)
+		}
+
+		values, ok := result.([]interface{})
+		if !ok || len(values) != 2 || values[1] != int64(2) {
+			t.Fatalf("engine %d: wrong result. got=%T", engine, result)
+		}
+		inner, ok := values[0].([]interface{})
+		if !ok || len(inner) != 2 || &inner[0] != &values[0] {
+			t.Errorf("engine %d: the array does not hold itself. got=%T", engine, values[0])
+		}
+	}
+}
+
+func TestRunKeepsBindings(t *testing.T) {
+	interp, _ := New()
+	ctx := context.Background()
+
+	if _, err := interp.Run(ctx, "let x = 20;"); err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+
+	result, err := interp.Run(ctx, "x + 1")
+	if err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+	if result != int64(21) {
+		t.Errorf("wrong result. got=%#v", result)
+	}
+}
+
+func TestHostFunctionsAndGlobals(t *testing.T) {
+	var out bytes.Buffer
+
+	interp, err := New(
+		WithGlobal("config", map[string]interface{}{"factor": 3, "names": []string{"a", "b"}}),
+		WithFunction("double", func(args ...interface{}) (interface{}, error) {
+			n, ok := args[0].(int64)
+			if !ok {
+				return nil, errors.New("want an integer")
+			}
+			return n * 2, nil
+		}),
+		WithOutput(&out),
+	)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+
+	result, err := interp.Run(context.Background(), `puts(config["names"]); double(config["factor"])`)
+	if err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+	if result != int64(6) {
+		t.Errorf("wrong result. got=%#v", result)
+	}
+	if out.String() != "[a, b]\n" {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+
+	_, err = interp.Run(context.Background(), `double("x")`)
+	rtErr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("error is not *RuntimeError. got=%T (%v)", err, err)
+	}
+	if rtErr.Message != "double: want an integer" {
+		t.Errorf("wrong message. got=%q", rtErr.Message)
+	}
+}
+
+func TestHandles(t *testing.T) {
+	ctx := context.Background()
+
+	for _, engine := range []Engine{EngineEval, EngineVM} {
+		interp, err := New(
+			WithEngine(engine),
+			WithFunction("same", func(args ...interface{}) (interface{}, error) {
+				if _, ok := args[0].(*Handle); !ok {
+					return nil, errors.New("want a handle")
+				}
+				return args[0], nil
+			}),
+		)
+		if err != nil {
+			t.Fatalf("New() failed: %s", err)
+		}
+
+		result, err := interp.Run(ctx, "let f = fn(x) { x * 2 }; same(f)(4)")
+		if err != nil {
+			t.Fatalf("Run failed: %s", err)
+		}
+		if result != int64(8) {
+			t.Errorf("wrong result. got=%#v", result)
+		}
+
+		result, err = interp.Run(ctx, "fn() { 1 }")
+		if err != nil {
+			t.Fatalf("Run failed: %s", err)
+		}
+		if _, ok := result.(*Handle); !ok {
+			t.Errorf("function is not returned as a *Handle. got=%T", result)
+		}
+	}
+}
+
+func TestWithGlobalRejectsUnsupportedValues(t *testing.T) {
+	_, err := New(WithGlobal("ch", make(chan int)))
+	if err == nil {
+		t.Fatalf("expected an error for a channel global")
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	for _, engine := range []Engine{EngineEval, EngineVM} {
+		interp, _ := New(WithEngine(engine))
+
+		_, err := interp.Run(context.Background(), "let = 1;")
+		parseErr, ok := err.(*ParseError)
+		if !ok {
+			t.Fatalf("error is not *ParseError. got=%T (%v)", err, err)
+		}
+		if len(parseErr.Diagnostics) != 1 {
+			t.Errorf("wrong number of diagnostics. got=%d", len(parseErr.Diagnostics))
+		}
+
+		_, err = interp.Run(context.Background(), "1 + true")
+		if _, ok := err.(*RuntimeError); !ok {
+			t.Fatalf("error is not *RuntimeError. got=%T (%v)", err, err)
+		}
+
+		_, err = interp.Run(context.Background(), "10 / 0")
+		if err == nil || err.Error() != "1:4: division by zero" {
+			t.Errorf("wrong division error. got=%v", err)
+		}
+
+		_, err = interp.Run(context.Background(), "let y = 1;\nx + y")
+		rtErr, ok := err.(*RuntimeError)
+		if !ok {
+			t.Fatalf("error is not *RuntimeError. got=%T (%v)", err, err)
+		}
+		if rtErr.Message != "identifier not found: x" || rtErr.Pos.Line != 2 || rtErr.Pos.Column != 1 {
+			t.Errorf("wrong error for an unknown identifier. got=%s", rtErr)
+		}
+
+		_, err = interp.Run(context.Background(), "const k = 1;\nk = 2")
+		if err == nil || err.Error() != "2:1: cannot assign to constant: k" {
+			t.Errorf("wrong error for assigning a constant. got=%T (%v)", err, err)
+		}
+
+		_, err = interp.Run(context.Background(), "let f = fn() { 1 / 0 };\nf()")
+		rtErr, ok = err.(*RuntimeError)
+		if !ok {
+			t.Fatalf("error is not *RuntimeError. got=%T (%v)", err, err)
+		}
+		if len(rtErr.Trace) != 1 || rtErr.Trace[0].Function != "f" || rtErr.Trace[0].Pos.Line != 2 {
+			t.Errorf("wrong trace. got=%+v", rtErr.Trace)
+		}
+		if rtErr.Traceback() != "\n    in `f` called at 2:1" {
+			t.Errorf("wrong traceback. got=%q", rtErr.Traceback())
+		}
+	}
+
+	broken, _ := New(WithFunction("boom", func(args ...interface{}) (interface{}, error) {
+		panic("boom")
+	}))
+	_, err := broken.Run(context.Background(), "boom()")
+	if rtErr, ok := err.(*RuntimeError); !ok || !rtErr.Internal {
+		t.Errorf("panic in host function not reported as internal. got=%T (%v)", err, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := broken.Run(ctx, "1"); err != context.Canceled {
+		t.Errorf("expected context.Canceled. got=%v", err)
+	}
+}
+
+func TestLimitsAndCancellation(t *testing.T) {
+	interp, _ := New(WithLimits(Limits{MaxSteps: 500}))
+
+	_, err := interp.Run(context.Background(), "let loop = fn(n) { loop(n + 1) }; loop(0)")
+	limitErr, ok := err.(*LimitError)
+	if !ok {
+		t.Fatalf("error is not *LimitError. got=%T (%v)", err, err)
+	}
+	if limitErr.Message != "step limit exceeded: 500" {
+		t.Errorf("wrong message. got=%q", limitErr.Message)
+	}
+
+	for _, engine := range []Engine{EngineEval, EngineVM} {
+		interp, _ := New(WithEngine(engine))
+
+		_, err := interp.Run(context.Background(), "let f = fn(n) { 1 + f(n) };\nf(1)")
+		if err == nil || err.Error() != "1:21: call depth limit exceeded: 10000" {
+			t.Errorf("engine %d: wrong error for the call depth. got=%T (%v)", engine, err, err)
+		}
+	}
+
+	interp, _ = New()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = interp.Run(ctx, "let spin = fn(n) { if (n > 0) { spin(n - 1); spin(n - 1) } }; spin(40)")
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded. got=%T (%v)", err, err)
+	}
+}
+
+func TestRunFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "script.mk")
+	if err := ioutil.WriteFile(filename, []byte("#!/usr/bin/env monkey\nlet x = ;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	interp, _ := New()
+	_, err = interp.RunFile(context.Background(), filename)
+	parseErr, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("error is not *ParseError. got=%T (%v)", err, err)
+	}
+
+	pos := parseErr.Diagnostics[0].Pos
+	if pos.Filename != filename || pos.Line != 2 || pos.Column != 9 {
+		t.Errorf("wrong position. got=%s", pos)
+	}
+}
@@ -0,0 +1,536 @@
+// object/arrays.go
+//
+// definitions for the array builtins. None of them modify the arrays they are
+// given, they return new ones instead.
+
+package object
+
+import (
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// arrayArg returns args[i] as an array, or an error naming the builtin
+func arrayArg(name string, args []Object, i int) (*Array, *Error) {
+	arr, ok := args[i].(*Array)
+	if !ok {
+		return nil, newError("argument to `%s` must be ARRAY, got %s", name, args[i].Type())
+	}
+	return arr, nil
+}
+
+// arrayBuiltin wraps a builtin taking an array and a fixed number of other
+// arguments
+func arrayBuiltin(name string, numArgs int, fn func(arr *Array, args []Object) Object) BuiltinFunction {
+	return func(args ...Object) Object {
+		if len(args) != numArgs {
+			return newError("wrong number of arguments. got=%d, want=%d", len(args), numArgs)
+		}
+
+		arr, err := arrayArg(name, args, 0)
+		if err != nil {
+			return err
+		}
+		return fn(arr, args[1:])
+	}
+}
+
+// callbackBuiltin wraps a higher order builtin taking an array and a
+// function, calling fn with each element in turn. visit returns false to
+// stop early.
+func callbackBuiltin(name string, visit func(el, result Object) bool, done func() Object) HigherOrderFunction {
+	return func(call Caller, args ...Object) Object {
+		if len(args) != 2 {
+			return newError("wrong number of arguments. got=%d, want=2", len(args))
+		}
+
+		arr, err := arrayArg(name, args, 0)
+		if err != nil {
+			return err
+		}
+
+		for _, el := range arr.Elements {
+			result := call(args[1], el)
+			if errObj, ok := result.(*Error); ok {
+				return errObj
+			}
+			if !visit(el, result) {
+				break
+			}
+		}
+		return done()
+	}
+}
+
+func arrayFirst(arr *Array, args []Object) Object {
+	if len(arr.Elements) == 0 {
+		return nil
+	}
+	return arr.Elements[0]
+}
+
+func arrayLast(arr *Array, args []Object) Object {
+	if len(arr.Elements) == 0 {
+		return nil
+	}
+	return arr.Elements[len(arr.Elements)-1]
+}
+
+// arrayRest returns all but the first element
+func arrayRest(arr *Array, args []Object) Object {
+	if len(arr.Elements) == 0 {
+		return nil
+	}
+	return newArray(arr.Elements[1:])
+}
+
+// arrayPush returns the array with the other arguments added to the end
+func arrayPush(args ...Object) Object {
+	if len(args) < 2 {
+		return newError("wrong number of arguments. got=%d, want=at least 2", len(args))
+	}
+
+	arr, err := arrayArg("push", args, 0)
+	if err != nil {
+		return err
+	}
+	return newArray(arr.Elements, args[1:]...)
+}
+
+// arrayPop returns the last element, the one pop removes in other
+// languages. The array is left as it is, like by every builtin; a[:-1] is
+// the array without it.
+func arrayPop(arr *Array, args []Object) Object {
+	if len(arr.Elements) == 0 {
+		return nil
+	}
+	return arr.Elements[len(arr.Elements)-1]
+}
+
+func arrayConcat(args ...Object) Object {
+	elements := []Object{}
+	for i := range args {
+		arr, err := arrayArg("concat", args, i)
+		if err != nil {
+			return err
+		}
+		elements = append(elements, arr.Elements...)
+	}
+	return &Array{Elements: elements}
+}
+
+// arraySlice returns the elements from start up to but not including end,
+// which defaults to the length. Negative bounds count from the end.
+func arraySlice(arr *Array, args []Object) Object {
+	start, end, err := sliceBounds("slice", len(arr.Elements), args)
+	if err != nil {
+		return err
+	}
+	return newArray(arr.Elements[start:end])
+}
+
+// sliceBounds turns the start and optional end given to a slicing builtin
+// into bounds within length. Negative bounds count from the end, and bounds
+// outside the sequence are clamped to it.
+func sliceBounds(name string, length int, bounds []Object) (int, int, *Error) {
+	result := [2]int{0, length}
+
+	for i, bound := range bounds {
+		value, ok := boundValue(bound)
+		if !ok {
+			return 0, 0, newError("bounds given to `%s` must be INTEGER, got %s", name, bound.Type())
+		}
+
+		if value < 0 {
+			value += int64(length)
+		}
+		result[i] = int(math.Max(0, math.Min(float64(value), float64(length))))
+	}
+
+	if result[1] < result[0] {
+		result[1] = result[0]
+	}
+	return result[0], result[1], nil
+}
+
+func arrayReverse(arr *Array, args []Object) Object {
+	elements := make([]Object, len(arr.Elements))
+	for i, el := range arr.Elements {
+		elements[len(elements)-1-i] = el
+	}
+	return &Array{Elements: elements}
+}
+
+// arraySort sorts numbers and strings in ascending order, or uses the given
+// function, which is called with two elements and returns whether the first
+// goes before the second
+func arraySort(call Caller, args ...Object) Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 to 2", len(args))
+	}
+
+	arr, errObj := arrayArg("sort", args, 0)
+	if errObj != nil {
+		return errObj
+	}
+
+	elements := newArray(arr.Elements).Elements
+
+	less := func(a, b Object) (bool, *Error) {
+		c, ok := Compare(a, b)
+		if !ok {
+			return false, newError("cannot compare %s and %s", a.Type(), b.Type())
+		}
+		return c < 0, nil
+	}
+	if len(args) == 2 {
+		less = func(a, b Object) (bool, *Error) {
+			switch result := call(args[1], a, b).(type) {
+			case *Error:
+				return false, result
+			case *Boolean:
+				return result.Value, nil
+			default:
+				return false, newError("comparator given to `sort` must return BOOLEAN, got %s", result.Type())
+			}
+		}
+	}
+
+	sort.SliceStable(elements, func(i, j int) bool {
+		if errObj != nil {
+			return false
+		}
+		var result bool
+		result, errObj = less(elements[i], elements[j])
+		return result
+	})
+
+	if errObj != nil {
+		return errObj
+	}
+	return &Array{Elements: elements}
+}
+
+func arrayContains(arr *Array, args []Object) Object {
+	return NativeBool(indexOf(arr.Elements, args[0]) >= 0)
+}
+
+// arrayIndexOf returns the index of the first element equal to the value,
+// or -1 if there is none
+func arrayIndexOf(arr *Array, args []Object) Object {
+	return &Integer{Value: int64(indexOf(arr.Elements, args[0]))}
+}
+
+func indexOf(elements []Object, val Object) int {
+	for i, el := range elements {
+		if Equal(el, val) {
+			return i
+		}
+	}
+	return -1
+}
+
+// arrayJoin joins the elements, with strings included as they are and other
+// values as they are printed, separated by an optional string
+func arrayJoin(args ...Object) Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 to 2", len(args))
+	}
+
+	arr, err := arrayArg("join", args, 0)
+	if err != nil {
+		return err
+	}
+
+	var sep string
+	if len(args) == 2 {
+		str, ok := args[1].(*String)
+		if !ok {
+			return newError("separator given to `join` must be STRING, got %s", args[1].Type())
+		}
+		sep = str.Value
+	}
+
+	parts := make([]string, len(arr.Elements))
+	for i, el := range arr.Elements {
+		parts[i] = inspect(el, map[Object]bool{arr: true})
+	}
+	return &String{Value: strings.Join(parts, sep)}
+}
+
+// arrayZip pairs up the elements of its arguments, stopping at the end of
+// the shortest one
+func arrayZip(args ...Object) Object {
+	if len(args) == 0 {
+		return newError("wrong number of arguments. got=0, want=at least 1")
+	}
+
+	arrays := make([]*Array, len(args))
+	length := -1
+	for i := range args {
+		arr, err := arrayArg("zip", args, i)
+		if err != nil {
+			return err
+		}
+		arrays[i] = arr
+		if length < 0 || len(arr.Elements) < length {
+			length = len(arr.Elements)
+		}
+	}
+
+	tuples := make([]Object, length)
+	for i := range tuples {
+		tuple := make([]Object, len(arrays))
+		for j, arr := range arrays {
+			tuple[j] = arr.Elements[i]
+		}
+		tuples[i] = &Array{Elements: tuple}
+	}
+	return &Array{Elements: tuples}
+}
+
+// arrayRange returns the integers from start up to but not including end,
+// counting by step. start defaults to 0 and step to 1.
+func arrayRange(budget *Budget, args ...Object) Object {
+	if len(args) < 1 || len(args) > 3 {
+		return newError("wrong number of arguments. got=%d, want=1 to 3", len(args))
+	}
+
+	bounds := []int64{0, 0, 1}
+	for i, arg := range args {
+		n, ok := arg.(*Integer)
+		if !ok {
+			return newError("arguments to `range` must be INTEGER, got %s", arg.Type())
+		}
+		bounds[i] = n.Value
+	}
+	if len(args) == 1 {
+		bounds[0], bounds[1] = 0, bounds[0]
+	}
+
+	start, end, step := bounds[0], bounds[1], bounds[2]
+	if step == 0 {
+		return newError("step given to `range` must not be 0")
+	}
+
+	// counted in uint64, where the distance between any two int64 fits
+	var n uint64
+	if step > 0 && start < end {
+		n = (uint64(end)-uint64(start)-1)/uint64(step) + 1
+	} else if step < 0 && start > end {
+		n = (uint64(start)-uint64(end)-1)/(uint64(-(step+1))+1) + 1
+	}
+	if n > math.MaxInt64 {
+		return newError("result of `range` is too large")
+	}
+	if err := budget.Reserve(int64(n)); err != nil {
+		return err
+	}
+
+	elements := make([]Object, n)
+	for k := range elements {
+		elements[k] = &Integer{Value: start + int64(k)*step}
+	}
+	return &Array{Elements: elements}
+}
+
+func arrayMap(call Caller, args ...Object) Object {
+	elements := []Object{}
+	return callbackBuiltin("map", func(el, result Object) bool {
+		elements = append(elements, result)
+		return true
+	}, func() Object {
+		return &Array{Elements: elements}
+	})(call, args...)
+}
+
+func arrayFilter(call Caller, args ...Object) Object {
+	elements := []Object{}
+	return callbackBuiltin("filter", func(el, result Object) bool {
+		if Truthy(result) {
+			elements = append(elements, el)
+		}
+		return true
+	}, func() Object {
+		return &Array{Elements: elements}
+	})(call, args...)
+}
+
+// arrayFind returns the first element the function returns a truthy value
+// for, or null
+func arrayFind(call Caller, args ...Object) Object {
+	var found Object
+	return callbackBuiltin("find", func(el, result Object) bool {
+		if Truthy(result) {
+			found = el
+			return false
+		}
+		return true
+	}, func() Object {
+		return found
+	})(call, args...)
+}
+
+func arrayAny(call Caller, args ...Object) Object {
+	any := false
+	return callbackBuiltin("any", func(el, result Object) bool {
+		any = Truthy(result)
+		return !any
+	}, func() Object {
+		return NativeBool(any)
+	})(call, args...)
+}
+
+func arrayAll(call Caller, args ...Object) Object {
+	all := true
+	return callbackBuiltin("all", func(el, result Object) bool {
+		all = Truthy(result)
+		return all
+	}, func() Object {
+		return NativeBool(all)
+	})(call, args...)
+}
+
+// arrayReduce combines the elements from left to right with the function,
+// starting from the initial value if one is given, or the first element
+func arrayReduce(call Caller, args ...Object) Object {
+	if len(args) != 2 && len(args) != 3 {
+		return newError("wrong number of arguments. got=%d, want=2 to 3", len(args))
+	}
+
+	arr, err := arrayArg("reduce", args, 0)
+	if err != nil {
+		return err
+	}
+
+	elements := arr.Elements
+	var acc Object
+	if len(args) == 3 {
+		acc = args[2]
+	} else if len(elements) > 0 {
+		acc, elements = elements[0], elements[1:]
+	} else {
+		return newError("`reduce` of an empty array needs an initial value")
+	}
+
+	for _, el := range elements {
+		acc = call(args[1], acc, el)
+		if errObj, ok := acc.(*Error); ok {
+			return errObj
+		}
+	}
+	return acc
+}
+
+// newArray copies elements into a new array, followed by more
+func newArray(elements []Object, more ...Object) *Array {
+	copied := make([]Object, 0, len(elements)+len(more))
+	copied = append(copied, elements...)
+	return &Array{Elements: append(copied, more...)}
+}
+
+// Truthy reports whether obj counts as true in a condition. Only null and
+// false do not.
+func Truthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Null:
+		return false
+	case *Boolean:
+		return obj.Value
+	default:
+		return true
+	}
+}
+
+// Equal reports whether a and b have the same value. Numbers, strings and
+// booleans compare by value, arrays by their elements and anything else by
+// identity.
+func Equal(a, b Object) bool {
+	return equal(a, b, map[[2]*Array]bool{})
+}
+
+// equal compares a and b, with seen holding the pairs of arrays being
+// compared, so arrays that hold themselves are taken as equal where they
+// recur instead of being compared forever
+func equal(a, b Object, seen map[[2]*Array]bool) bool {
+	if c, ok := Compare(a, b); ok {
+		return c == 0
+	}
+
+	switch a := a.(type) {
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+	case *Null:
+		_, ok := b.(*Null)
+		return ok
+	case *Array:
+		b, ok := b.(*Array)
+		if !ok || len(a.Elements) != len(b.Elements) {
+			return false
+		}
+		pair := [2]*Array{a, b}
+		if a == b || seen[pair] {
+			return true
+		}
+		seen[pair] = true
+		for i := range a.Elements {
+			if !equal(a.Elements[i], b.Elements[i], seen) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
+
+// Compare orders two numbers or two strings, returning a negative number,
+// zero or a positive number when a is less than, equal to or greater than b.
+// It returns false for any other values.
+func Compare(a, b Object) (int, bool) {
+	if a, ok := a.(*String); ok {
+		b, ok := b.(*String)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(a.Value, b.Value), true
+	}
+
+	if x, ok := a.(*Integer); ok {
+		if y, ok := b.(*Integer); ok {
+			switch {
+			case x.Value < y.Value:
+				return -1, true
+			case x.Value > y.Value:
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+
+	x, xok := BigValue(a)
+	y, yok := BigValue(b)
+	if xok && yok {
+		return x.Cmp(y), true
+	}
+
+	fx, xok := floatValue(a)
+	fy, yok := floatValue(b)
+	if !xok || !yok || math.IsNaN(fx) || math.IsNaN(fy) {
+		return 0, false
+	}
+
+	// compared exactly, as an integer may not fit in a float
+	return bigFloatValue(a).Cmp(bigFloatValue(b)), true
+}
+
+func bigFloatValue(obj Object) *big.Float {
+	if f, ok := obj.(*Float); ok {
+		return big.NewFloat(f.Value)
+	}
+	n, _ := BigValue(obj)
+	return new(big.Float).SetInt(n)
+}
@@ -0,0 +1,263 @@
+// object/builtins.go
+//
+// definitions for built in functions, shared by the evaluator and the vm
+
+package object
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Builtins lists every built in function. The vm refers to them by index, so
+// new entries must be added at the end.
+var Builtins = []struct {
+	Name    string
+	Builtin *Builtin
+}{
+	{
+		"len",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *String:
+				return &Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+			case *Array:
+				return &Integer{Value: int64(len(arg.Elements))}
+			default:
+				return newError("argument to `len` not supported, got %s", args[0].Type())
+			}
+		},
+		},
+	},
+	{
+		"puts",
+		&Builtin{Fn: func(args ...Object) Object {
+			for _, arg := range args {
+				fmt.Println(arg.Inspect())
+			}
+
+			return nil
+		},
+		},
+	},
+	{"abs", &Builtin{Fn: mathAbs}},
+	{"floor", &Builtin{Fn: mathFunction("floor", math.Floor)}},
+	{"ceil", &Builtin{Fn: mathFunction("ceil", math.Ceil)}},
+	{"sqrt", &Builtin{Fn: mathFunction("sqrt", math.Sqrt)}},
+	{"round", &Builtin{Fn: mathRound}},
+	{"pow", &Builtin{Fn: mathPow}},
+	{"int", &Builtin{Fn: toInteger}},
+	{"float", &Builtin{Fn: toFloat}},
+	{"error", &Builtin{Fn: newErrorValue}},
+	{"first", &Builtin{Fn: arrayBuiltin("first", 1, arrayFirst)}},
+	{"last", &Builtin{Fn: arrayBuiltin("last", 1, arrayLast)}},
+	{"rest", &Builtin{Fn: arrayBuiltin("rest", 1, arrayRest)}},
+	{"push", &Builtin{Fn: arrayPush}},
+	{"pop", &Builtin{Fn: arrayBuiltin("pop", 1, arrayPop)}},
+	{"concat", &Builtin{Fn: arrayConcat}},
+	{"slice", &Builtin{Fn: sequenceBuiltin("slice", 2, 3, arraySlice, stringSlice("slice"))}},
+	{"reverse", &Builtin{Fn: arrayBuiltin("reverse", 1, arrayReverse)}},
+	{"sort", &Builtin{HigherOrder: arraySort}},
+	{"contains", &Builtin{Fn: sequenceBuiltin("contains", 2, 2, arrayContains, stringContains)}},
+	{"index_of", &Builtin{Fn: sequenceBuiltin("index_of", 2, 2, arrayIndexOf, stringIndexOf)}},
+	{"join", &Builtin{Fn: arrayJoin}},
+	{"zip", &Builtin{Fn: arrayZip}},
+	{"range", &Builtin{Sized: arrayRange}},
+	{"map", &Builtin{HigherOrder: arrayMap}},
+	{"filter", &Builtin{HigherOrder: arrayFilter}},
+	{"reduce", &Builtin{HigherOrder: arrayReduce}},
+	{"find", &Builtin{HigherOrder: arrayFind}},
+	{"any", &Builtin{HigherOrder: arrayAny}},
+	{"all", &Builtin{HigherOrder: arrayAll}},
+	{"split", &Builtin{Fn: stringBuiltin("split", 1, 2, stringSplit)}},
+	{"trim", &Builtin{Fn: stringBuiltin("trim", 1, 2, stringTrim(strings.Trim, strings.TrimSpace))}},
+	{"trim_left", &Builtin{Fn: stringBuiltin("trim_left", 1, 2, stringTrim(strings.TrimLeft, trimLeftSpace))}},
+	{"trim_right", &Builtin{Fn: stringBuiltin("trim_right", 1, 2, stringTrim(strings.TrimRight, trimRightSpace))}},
+	{"upper", &Builtin{Fn: stringBuiltin("upper", 1, 1, stringUpper)}},
+	{"lower", &Builtin{Fn: stringBuiltin("lower", 1, 1, stringLower)}},
+	{"replace", &Builtin{Fn: stringReplace}},
+	{"starts_with", &Builtin{Fn: stringBuiltin("starts_with", 2, 2, stringStartsWith)}},
+	{"ends_with", &Builtin{Fn: stringBuiltin("ends_with", 2, 2, stringEndsWith)}},
+	{"substring", &Builtin{Fn: stringSubstring}},
+	{"repeat", &Builtin{Sized: stringRepeat}},
+	{"pad", &Builtin{Sized: stringPad}},
+	{"chars", &Builtin{Fn: stringBuiltin("chars", 1, 1, stringChars)}},
+	{"bytes", &Builtin{Fn: stringBuiltin("bytes", 1, 1, stringBytes)}},
+	{"str", &Builtin{Fn: toString}},
+	{"bool", &Builtin{Fn: toBoolean}},
+}
+
+// mathFunction wraps a one argument function from the math package. Integer
+// arguments are converted and the result is always a FLOAT.
+func mathFunction(name string, fn func(float64) float64) BuiltinFunction {
+	return func(args ...Object) Object {
+		if len(args) != 1 {
+			return newError("wrong number of arguments. got=%d, want=1", len(args))
+		}
+
+		x, ok := floatValue(args[0])
+		if !ok {
+			return newError("argument to `%s` not supported, got %s", name, args[0].Type())
+		}
+		return &Float{Value: fn(x)}
+	}
+}
+
+func mathAbs(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *Integer:
+		if arg.Value >= 0 {
+			return arg
+		}
+		if value, ok := NegInt64(arg.Value); ok {
+			return &Integer{Value: value}
+		}
+		return NewBigInteger(new(big.Int).Neg(big.NewInt(arg.Value)))
+	case *BigInteger:
+		return &BigInteger{Value: new(big.Int).Abs(arg.Value)}
+	case *Float:
+		return &Float{Value: math.Abs(arg.Value)}
+	default:
+		return newError("argument to `abs` not supported, got %s", args[0].Type())
+	}
+}
+
+// mathRound rounds half away from zero, to a number of decimal places if
+// one is given
+func mathRound(args ...Object) Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 to 2", len(args))
+	}
+
+	x, ok := floatValue(args[0])
+	if !ok {
+		return newError("argument to `round` not supported, got %s", args[0].Type())
+	}
+
+	if len(args) == 1 {
+		return &Float{Value: math.Round(x)}
+	}
+
+	places, ok := args[1].(*Integer)
+	if !ok {
+		return newError("places given to `round` must be INTEGER, got %s", args[1].Type())
+	}
+
+	scale := math.Pow(10, float64(places.Value))
+	return &Float{Value: math.Round(x*scale) / scale}
+}
+
+func mathPow(args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	x, okX := floatValue(args[0])
+	y, okY := floatValue(args[1])
+	if !okX || !okY {
+		return newError("arguments to `pow` not supported, got %s and %s", args[0].Type(), args[1].Type())
+	}
+	return &Float{Value: math.Pow(x, y)}
+}
+
+// toInteger converts a number, truncating toward zero, or parses a string
+func toInteger(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *Integer, *BigInteger:
+		return arg
+	case *Float:
+		if math.IsNaN(arg.Value) || math.IsInf(arg.Value, 0) {
+			return newError("cannot convert %s to INTEGER", arg.Inspect())
+		}
+		value, _ := big.NewFloat(arg.Value).Int(nil)
+		return NewBigInteger(value)
+	case *String:
+		value, ok := new(big.Int).SetString(arg.Value, 10)
+		if !ok {
+			return newError("could not parse %q as integer", arg.Value)
+		}
+		return NewBigInteger(value)
+	default:
+		return newError("argument to `int` not supported, got %s", args[0].Type())
+	}
+}
+
+// toFloat converts a number or parses a string
+func toFloat(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *String:
+		value, err := strconv.ParseFloat(arg.Value, 64)
+		if err != nil {
+			return newError("could not parse %q as float", arg.Value)
+		}
+		return &Float{Value: value}
+	}
+
+	x, ok := floatValue(args[0])
+	if !ok {
+		return newError("argument to `float` not supported, got %s", args[0].Type())
+	}
+	return &Float{Value: x}
+}
+
+// newErrorValue creates an error value that can be thrown later
+func newErrorValue(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	message, ok := args[0].(*String)
+	if !ok {
+		return newError("argument to `error` must be STRING, got %s", args[0].Type())
+	}
+	return &ErrorValue{Err: &Error{Kind: RUNTIME_ERROR, Message: message.Value}}
+}
+
+// floatValue returns the value of an INTEGER or FLOAT as a float64
+func floatValue(obj Object) (float64, bool) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return float64(obj.Value), true
+	case *BigInteger:
+		f, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return f, true
+	case *Float:
+		return obj.Value, true
+	default:
+		return 0, false
+	}
+}
+
+// GetBuiltinByName returns the builtin called name, or nil if there is none
+func GetBuiltinByName(name string) *Builtin {
+	for _, def := range Builtins {
+		if def.Name == name {
+			return def.Builtin
+		}
+	}
+	return nil
+}
+
+func newError(format string, a ...interface{}) *Error {
+	return &Error{Kind: RUNTIME_ERROR, Message: fmt.Sprintf(format, a...)}
+}
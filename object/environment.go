@@ -12,14 +12,26 @@ func NewEnvironment() *Environment {
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outer
+	env.strict = outer.strict
 	return env
 }
 
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store  map[string]Object
+	consts map[string]bool // names declared with const, created on first use
+	outer  *Environment
+	strict bool
 }
 
+// SetStrict makes Declare reject redeclaring a name in the same scope or
+// shadowing one from an enclosing scope. Environments enclosed by this one
+// afterwards are strict too.
+func (e *Environment) SetStrict(strict bool) { e.strict = strict }
+
+// Strict reports whether the environment is strict, which also makes
+// indexing out of range an error rather than null
+func (e *Environment) Strict() bool { return e.strict }
+
 func (e *Environment) Get(name string) (Object, bool) {
 	obj, ok := e.store[name]
 	if !ok && e.outer != nil {
@@ -28,7 +40,57 @@ func (e *Environment) Get(name string) (Object, bool) {
 	return obj, ok
 }
 
+// Names returns the names bound in this scope, not in enclosing ones
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	return names
+}
+
 func (e *Environment) Set(name string, val Object) Object {
 	e.store[name] = val
 	return val
 }
+
+// Declare binds name in this scope for a let or const statement. A constant
+// can never be redeclared, and in a strict environment no name can.
+func (e *Environment) Declare(name string, val Object, constant bool) *Error {
+	if _, ok := e.store[name]; ok {
+		if e.consts[name] {
+			return newError("cannot redeclare constant: %s", name)
+		}
+		if e.strict {
+			return newError("%s is already declared in this scope", name)
+		}
+	} else if e.strict && e.outer != nil {
+		if _, ok := e.outer.Get(name); ok {
+			return newError("%s shadows a binding in an enclosing scope", name)
+		}
+	}
+
+	e.store[name] = val
+	if constant {
+		if e.consts == nil {
+			e.consts = make(map[string]bool)
+		}
+		e.consts[name] = true
+	}
+	return nil
+}
+
+// Assign rebinds name in the scope that defines it, failing if no enclosing
+// scope does or it is a constant
+func (e *Environment) Assign(name string, val Object) *Error {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			if env.consts[name] {
+				return newError("cannot assign to constant: %s", name)
+			}
+			env.store[name] = val
+			return nil
+		}
+	}
+	return newError("cannot assign to undeclared identifier: %s", name)
+}
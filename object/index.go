@@ -0,0 +1,161 @@
+// object/index.go
+//
+// definitions for indexing and slicing arrays and strings, shared by the
+// evaluator and the vm
+
+package object
+
+import "math"
+
+// ElementIndex turns index into a position within a sequence of length
+// elements, counting from the end when it is negative. It reports false when
+// index is not an integer within the sequence.
+func ElementIndex(index Object, length int) (int, bool) {
+	integer, ok := index.(*Integer)
+	if !ok {
+		// a BigInteger is out of range of any sequence
+		return 0, false
+	}
+
+	i := integer.Value
+	if i < 0 {
+		i += int64(length)
+	}
+	if i < 0 || i >= int64(length) {
+		return 0, false
+	}
+	return int(i), true
+}
+
+// IndexSequence returns the element of an array, or the character of a
+// string, at index. An index out of range gives nil for null, or an error
+// when strict is set.
+func IndexSequence(seq, index Object, strict bool) Object {
+	switch seq := seq.(type) {
+	case *Array:
+		if i, ok := ElementIndex(index, len(seq.Elements)); ok {
+			return seq.Elements[i]
+		}
+	case *String:
+		chars := []rune(seq.Value)
+		if i, ok := ElementIndex(index, len(chars)); ok {
+			return &String{Value: string(chars[i])}
+		}
+	default:
+		return newError("index operator not supported: %s", seq.Type())
+	}
+
+	if strict {
+		return newError("index out of range: %s", index.Inspect())
+	}
+	return nil
+}
+
+// Slice returns the elements of an array, or the characters of a string,
+// from start up to but not including end, taking every step-th one. Like in
+// Python, negative bounds count from the end, bounds outside the sequence
+// are clamped to it, and a negative step walks it backwards. Bounds that are
+// nil or null are left out, defaulting to the whole sequence.
+func Slice(seq, start, end, step Object) Object {
+	var length int
+	var chars []rune
+
+	switch seq := seq.(type) {
+	case *Array:
+		length = len(seq.Elements)
+	case *String:
+		chars = []rune(seq.Value)
+		length = len(chars)
+	default:
+		return newError("slice operator not supported: %s", seq.Type())
+	}
+
+	n := int64(1)
+	if !omitted(step) {
+		var err *Error
+		if n, err = sliceInt("step", step); err != nil {
+			return err
+		}
+		if n == 0 {
+			return newError("slice step cannot be zero")
+		}
+		// a larger step takes nothing more than the first element
+		n = int64(math.Max(-float64(length+1), math.Min(float64(n), float64(length+1))))
+	}
+
+	// a backwards slice runs from the last element down to before the first
+	from, to := int64(0), int64(length)
+	lower, upper := int64(0), int64(length)
+	if n < 0 {
+		from, to = int64(length-1), -1
+		lower, upper = -1, int64(length-1)
+	}
+
+	bounds := []*int64{&from, &to}
+	for i, bound := range []Object{start, end} {
+		if omitted(bound) {
+			continue
+		}
+		value, err := sliceInt("bounds", bound)
+		if err != nil {
+			return err
+		}
+		if value < 0 {
+			value += int64(length)
+		}
+		*bounds[i] = int64(math.Max(float64(lower), math.Min(float64(value), float64(upper))))
+	}
+
+	var indices []int64
+	for i := from; n > 0 && i < to || n < 0 && i > to; i += n {
+		indices = append(indices, i)
+	}
+
+	if _, ok := seq.(*String); ok {
+		sliced := make([]rune, len(indices))
+		for k, i := range indices {
+			sliced[k] = chars[i]
+		}
+		return &String{Value: string(sliced)}
+	}
+
+	elements := seq.(*Array).Elements
+	sliced := make([]Object, len(indices))
+	for k, i := range indices {
+		sliced[k] = elements[i]
+	}
+	return &Array{Elements: sliced}
+}
+
+func omitted(bound Object) bool {
+	if bound == nil {
+		return true
+	}
+	_, ok := bound.(*Null)
+	return ok
+}
+
+// sliceInt returns the value of a slice bound or step
+func sliceInt(what string, obj Object) (int64, *Error) {
+	value, ok := boundValue(obj)
+	if !ok {
+		return 0, newError("slice %s must be INTEGER, got %s", what, obj.Type())
+	}
+	return value, nil
+}
+
+// boundValue returns the value of an integer used as a slice bound, with a
+// BigInteger taken as the closest int64 that still clamps like it would
+func boundValue(obj Object) (int64, bool) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return obj.Value, true
+	case *BigInteger:
+		if obj.Value.Sign() < 0 {
+			return math.MinInt64 / 2, true
+		}
+		return math.MaxInt64 / 2, true
+	default:
+		return 0, false
+	}
+}
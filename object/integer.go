@@ -0,0 +1,96 @@
+// object/integer.go
+//
+// defines arbitrary precision integers and the overflow checks that decide
+// when an Integer has to become one
+
+package object
+
+import (
+	"hash/fnv"
+	"math"
+	"math/big"
+)
+
+// BigInteger is an integer too large for an Integer. It reports the INTEGER
+// type, so the two are interchangeable in Monkey code. Results that fit in 64
+// bits are always turned back into an Integer by NewBigInteger.
+type BigInteger struct {
+	Value *big.Int
+}
+
+// Inspect returns the exact value
+func (bi *BigInteger) Inspect() string { return bi.Value.String() }
+
+// Type returns the type
+func (bi *BigInteger) Type() ObjectType { return INTEGER_OBJ }
+
+// HashKey ...
+func (bi *BigInteger) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write(bi.Value.Bytes())
+	if bi.Value.Sign() < 0 {
+		h.Write([]byte{'-'})
+	}
+
+	return HashKey{Type: bi.Type(), Value: h.Sum64()}
+}
+
+// NewBigInteger returns v as an Integer if it fits in 64 bits, or as a
+// BigInteger otherwise
+func NewBigInteger(v *big.Int) Object {
+	if v.IsInt64() {
+		return &Integer{Value: v.Int64()}
+	}
+	return &BigInteger{Value: v}
+}
+
+// BigValue returns the value of an Integer or BigInteger as a big.Int. The
+// result is a copy, so it can be modified.
+func BigValue(obj Object) (*big.Int, bool) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return big.NewInt(obj.Value), true
+	case *BigInteger:
+		return new(big.Int).Set(obj.Value), true
+	default:
+		return nil, false
+	}
+}
+
+// AddInt64 returns a + b, and false if the sum overflows
+func AddInt64(a, b int64) (int64, bool) {
+	c := a + b
+	return c, (c > a) == (b > 0)
+}
+
+// SubInt64 returns a - b, and false if the difference overflows
+func SubInt64(a, b int64) (int64, bool) {
+	c := a - b
+	return c, (c < a) == (b > 0)
+}
+
+// MulInt64 returns a * b, and false if the product overflows
+func MulInt64(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	c := a * b
+	if (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return c, false
+	}
+	return c, c/b == a
+}
+
+// DivInt64 returns a / b truncated toward zero, and false if the quotient
+// overflows, which only happens for math.MinInt64 / -1
+func DivInt64(a, b int64) (int64, bool) {
+	if a == math.MinInt64 && b == -1 {
+		return 0, false
+	}
+	return a / b, true
+}
+
+// NegInt64 returns -a, and false if the result overflows
+func NegInt64(a int64) (int64, bool) {
+	return -a, a != math.MinInt64
+}
@@ -0,0 +1,150 @@
+// object/limits.go
+//
+// definitions for bounding the resources a program may use, shared by the
+// evaluator and the vm
+
+package object
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DefaultMaxDepth is the call depth allowed when Limits.MaxDepth is zero. It
+// keeps runaway recursion from overflowing the Go stack.
+const DefaultMaxDepth = 10000
+
+// checkInterval is how many steps pass between checks of the context
+const checkInterval = 256
+
+// Limits bounds the resources a run may use. Zero values mean no limit,
+// except for MaxDepth which falls back to DefaultMaxDepth.
+type Limits struct {
+	MaxSteps       int64         // AST nodes evaluated, or instructions executed by the vm
+	MaxDepth       int           // depth of nested function calls, tail calls excluded
+	Timeout        time.Duration // wall clock time
+	MaxAllocations int64         // array elements, hash pairs and string bytes created
+}
+
+// Budget counts the resources used by one run against its Limits. A nil
+// Budget has no limits but the default call depth.
+type Budget struct {
+	ctx    context.Context
+	limits Limits
+
+	steps     int64
+	allocated int64
+}
+
+// NewBudget starts counting a run against limits, which is canceled along
+// with ctx. The returned function releases the timer of a Timeout.
+func NewBudget(ctx context.Context, limits Limits) (*Budget, context.CancelFunc) {
+	if limits.MaxDepth == 0 {
+		limits.MaxDepth = DefaultMaxDepth
+	}
+
+	cancel := func() {}
+	if limits.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, limits.Timeout)
+	}
+
+	return &Budget{ctx: ctx, limits: limits}, cancel
+}
+
+// NewLimitError creates the error reported when a limit is exceeded
+func NewLimitError(format string, a ...interface{}) *Error {
+	return &Error{Kind: LIMIT_ERROR, Message: fmt.Sprintf(format, a...)}
+}
+
+// MaxDepth returns the depth of nested calls allowed
+func (b *Budget) MaxDepth() int {
+	if b == nil {
+		return DefaultMaxDepth
+	}
+	return b.limits.MaxDepth
+}
+
+// Step counts one evaluated node or executed instruction
+func (b *Budget) Step() *Error {
+	if b == nil {
+		return nil
+	}
+
+	b.steps++
+
+	if b.limits.MaxSteps > 0 && b.steps > b.limits.MaxSteps {
+		return NewLimitError("step limit exceeded: %d", b.limits.MaxSteps)
+	}
+
+	if b.steps%checkInterval == 0 {
+		return b.CheckContext()
+	}
+
+	return nil
+}
+
+// CheckContext reports a limit error once the context of the run is done
+func (b *Budget) CheckContext() *Error {
+	if b == nil {
+		return nil
+	}
+
+	select {
+	case <-b.ctx.Done():
+	default:
+		return nil
+	}
+
+	if b.ctx.Err() == context.DeadlineExceeded {
+		return NewLimitError("execution timed out")
+	}
+	return NewLimitError("execution canceled: %s", b.ctx.Err())
+}
+
+// Track counts the size of a newly created object against the allocation
+// limit
+func (b *Budget) Track(obj Object) *Error {
+	switch obj := obj.(type) {
+	case *Array:
+		return b.Allocate(int64(len(obj.Elements)))
+	case *Hash:
+		return b.Allocate(int64(len(obj.Pairs)))
+	case *String:
+		return b.Allocate(int64(len(obj.Value)))
+	default:
+		return nil
+	}
+}
+
+// Allocate counts size more elements against the allocation limit, such as
+// an entry added to an existing hash
+func (b *Budget) Allocate(size int64) *Error {
+	if b == nil || b.limits.MaxAllocations <= 0 {
+		return nil
+	}
+
+	b.allocated += size
+	if b.allocated > b.limits.MaxAllocations {
+		return NewLimitError("allocation limit exceeded: %d", b.limits.MaxAllocations)
+	}
+	return nil
+}
+
+// Reserve checks that size more elements fit in what is left of the
+// allocation limit, without counting them. Builtins whose arguments choose
+// the size of their result call it before building the result, which is
+// counted once they return it.
+func (b *Budget) Reserve(size int64) *Error {
+	if size < 0 {
+		return newError("cannot allocate %d elements", size)
+	}
+	if b == nil || b.limits.MaxAllocations <= 0 {
+		return nil
+	}
+
+	if size > b.limits.MaxAllocations-b.allocated {
+		return NewLimitError("allocation limit exceeded: %d", b.limits.MaxAllocations)
+	}
+	return nil
+}
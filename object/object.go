@@ -7,9 +7,15 @@ package object
 import (
 	"bytes"
 	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
 	"strings"
 
 	"../ast"
+	"../code"
+	"../token"
 )
 
 // ObjectType defines the type
@@ -17,6 +23,7 @@ type ObjectType string
 
 const (
 	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	NULL_OBJ         = "NULL"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
@@ -25,6 +32,12 @@ const (
 	STRING_OBJ       = "STRING"
 	BUILTIN_OBJ      = "BUILTIN"
 	ARRAY_OBJ        = "ARRAY"
+	HASH_OBJ         = "HASH"
+	ERROR_VALUE_OBJ  = "ERROR_VALUE"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
 )
 
 // Object is a thing
@@ -33,6 +46,17 @@ type Object interface {
 	Inspect() string
 }
 
+// HashKey identifies a value used as a key in a Hash
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+// Hashable is implemented by objects that can be used as hash keys
+type Hashable interface {
+	HashKey() HashKey
+}
+
 // Integer are numbers
 type Integer struct {
 	Value int64
@@ -44,17 +68,72 @@ func (i *Integer) Inspect() string { return fmt.Sprintf("%d", i.Value) }
 // Type returns the type
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 
+// HashKey ...
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+// Float are floating point numbers
+type Float struct {
+	Value float64
+}
+
+// Inspect returns the shortest representation that reads back as the same
+// value, always with a fraction or exponent so it is not mistaken for an
+// Integer
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if strings.ContainsAny(s, ".eIN") {
+		return s
+	}
+	return s + ".0"
+}
+
+// Type returns the type
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+
+// HashKey ...
+func (f *Float) HashKey() HashKey {
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
 // Boolean are true or false
 type Boolean struct {
 	Value bool
 }
 
+// True and False are the booleans used by the builtins and both engines, so
+// booleans can be compared by identity
+var (
+	True  = &Boolean{Value: true}
+	False = &Boolean{Value: false}
+)
+
+// NativeBool returns True or False
+func NativeBool(value bool) *Boolean {
+	if value {
+		return True
+	}
+	return False
+}
+
 // Inspect ...
 func (b *Boolean) Inspect() string { return fmt.Sprintf("%t", b.Value) }
 
 // Type ...
 func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
 
+// HashKey ...
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+
+	if b.Value {
+		value = 1
+	}
+
+	return HashKey{Type: b.Type(), Value: value}
+}
+
 // Null object
 type Null struct{}
 
@@ -75,38 +154,191 @@ func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 // Inspect ...
 func (rv *ReturnValue) Inspect() string { return rv.Value.Inspect() }
 
+// Break is left by a break statement. Like a ReturnValue it is passed up
+// through blocks, until the enclosing loop sees it.
+type Break struct{}
+
+// Type ...
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+
+// Inspect ...
+func (b *Break) Inspect() string { return "break" }
+
+// Continue is left by a continue statement, see Break
+type Continue struct{}
+
+// Type ...
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+
+// Inspect ...
+func (c *Continue) Inspect() string { return "continue" }
+
+// ErrorKind classifies errors
+type ErrorKind string
+
+const (
+	RUNTIME_ERROR  = "RUNTIME_ERROR"  // the program did something invalid
+	LIMIT_ERROR    = "LIMIT_ERROR"    // an execution limit was hit or evaluation was canceled
+	INTERNAL_ERROR = "INTERNAL_ERROR" // the interpreter itself failed, a bug rather than a program error
+)
+
 // Error has a message
 type Error struct {
+	Kind    ErrorKind
 	Message string
+	Pos     token.Position // where the error happened, if known
+	Trace   []Frame        // the calls active when it happened, innermost first
 }
 
 // Type ...
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
 
+// Inspect prints the message followed by the traceback, if any
+func (e *Error) Inspect() string {
+	var out bytes.Buffer
+
+	out.WriteString("ERROR: ")
+	if e.Pos.IsValid() {
+		out.WriteString(e.Pos.String())
+		out.WriteString(": ")
+	}
+	out.WriteString(e.Message)
+	out.WriteString(FormatTrace(e.Trace))
+
+	return out.String()
+}
+
+// Error lets an Error be returned as a Go error
+func (e *Error) Error() string { return e.Message }
+
+// Frame is a function call on the call stack
+type Frame struct {
+	Function string         // the name of the function, empty if anonymous
+	Pos      token.Position // where it was called
+}
+
+// String describes the call, e.g. "in `add` called at 3:1"
+func (f Frame) String() string {
+	name := "anonymous function"
+	if f.Function != "" {
+		name = "`" + f.Function + "`"
+	}
+	return fmt.Sprintf("in %s called at %s", name, f.Pos)
+}
+
+// FormatTrace renders a trace with one indented line per frame, each line
+// starting with a newline. Runs of identical frames, as left by recursion,
+// are collapsed into a single line and a count.
+func FormatTrace(trace []Frame) string {
+	var out bytes.Buffer
+
+	for i := 0; i < len(trace); {
+		j := i + 1
+		for j < len(trace) && trace[j] == trace[i] {
+			j++
+		}
+
+		out.WriteString("\n    ")
+		out.WriteString(trace[i].String())
+		if repeated := j - i - 1; repeated > 0 {
+			fmt.Fprintf(&out, "\n    ... repeated %d more times", repeated)
+		}
+
+		i = j
+	}
+
+	return out.String()
+}
+
+// ErrorValue is an Error held as an ordinary value, as bound by catch or
+// created by the error builtin. Unlike an Error it does not abort evaluation
+// until it is thrown.
+type ErrorValue struct {
+	Err *Error
+}
+
+// Type ...
+func (ev *ErrorValue) Type() ObjectType { return ERROR_VALUE_OBJ }
+
 // Inspect ...
-func (e *Error) Inspect() string { return "ERROR: " + e.Message }
+func (ev *ErrorValue) Inspect() string { return ev.Err.Inspect() }
+
+// Field returns the message, kind or trace of the error, or false for any
+// other name
+func (ev *ErrorValue) Field(name string) (Object, bool) {
+	switch name {
+	case "message":
+		return &String{Value: ev.Err.Message}, true
+	case "kind":
+		return &String{Value: string(ev.Err.Kind)}, true
+	case "trace":
+		frames := make([]Object, len(ev.Err.Trace))
+		for i, frame := range ev.Err.Trace {
+			frames[i] = &String{Value: frame.String()}
+		}
+		return &Array{Elements: frames}, true
+	default:
+		return nil, false
+	}
+}
+
+// Thrown returns the Error raised by throwing val. An error value keeps the
+// position and trace it already has; any other value becomes the message.
+func Thrown(val Object) *Error {
+	switch val := val.(type) {
+	case *ErrorValue:
+		thrown := *val.Err
+		return &thrown
+	case *String:
+		return &Error{Kind: RUNTIME_ERROR, Message: val.Value}
+	default:
+		return &Error{Kind: RUNTIME_ERROR, Message: val.Inspect()}
+	}
+}
 
 type Function struct {
+	Name       string // the name given by let, empty for anonymous functions
 	Parameters []*ast.Identifier
+	Defaults   []ast.Expression // default value of each parameter, nil if required
+	Rest       *ast.Identifier  // collects extra arguments, if any
 	Body       *ast.BlockStatement
 	Env        *Environment
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
 
-func (f *Function) Inspect() string {
-	var out bytes.Buffer
+// Describe names the function for error messages
+func (f *Function) Describe() string {
+	if f.Name == "" {
+		return "anonymous function"
+	}
+	return "`" + f.Name + "`"
+}
 
-	params := []string{}
-	for _, p := range f.Parameters {
-		params = append(params, p.String())
+// Required returns the number of parameters without a default
+func (f *Function) Required() int {
+	for i := range f.Parameters {
+		if i < len(f.Defaults) && f.Defaults[i] != nil {
+			return i
+		}
 	}
+	return len(f.Parameters)
+}
+
+func (f *Function) Inspect() string {
+	return inspectFunction(f.Parameters, f.Defaults, f.Rest, f.Body)
+}
+
+// inspectFunction prints a function from its source, the same way on both
+// engines
+func inspectFunction(params []*ast.Identifier, defaults []ast.Expression, rest *ast.Identifier, body *ast.BlockStatement) string {
+	var out bytes.Buffer
 
 	out.WriteString("fn")
 	out.WriteString("(")
-	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(ast.FormatParameters(params, defaults, rest))
 	out.WriteString(") {\n")
-	out.WriteString(f.Body.String())
+	out.WriteString(body.String())
 	out.WriteString("\n}")
 
 	return out.String()
@@ -118,11 +350,42 @@ type String struct {
 
 func (s *String) Type() ObjectType { return STRING_OBJ }
 func (s *String) Inspect() string  { return s.Value }
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
 
 type BuiltinFunction func(args ...Object) Object
 
+// Caller calls a Monkey function on the engine running the program
+type Caller func(fn Object, args ...Object) Object
+
+// HigherOrderFunction is a builtin that calls functions passed to it
+type HigherOrderFunction func(call Caller, args ...Object) Object
+
+// SizedFunction is a builtin whose arguments choose the size of its result,
+// which it checks against the allocation limit before building it
+type SizedFunction func(budget *Budget, args ...Object) Object
+
 type Builtin struct {
-	Fn BuiltinFunction
+	Fn          BuiltinFunction
+	HigherOrder HigherOrderFunction // set instead of Fn by builtins taking functions
+	Sized       SizedFunction       // set instead of Fn by builtins building large results
+}
+
+// Call runs the builtin, with call used to run any function it is given and
+// budget holding the limits of the run
+func (b *Builtin) Call(call Caller, budget *Budget, args ...Object) Object {
+	switch {
+	case b.HigherOrder != nil:
+		return b.HigherOrder(call, args...)
+	case b.Sized != nil:
+		return b.Sized(budget, args...)
+	default:
+		return b.Fn(args...)
+	}
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
@@ -133,16 +396,173 @@ type Array struct {
 }
 
 func (ao *Array) Type() ObjectType { return ARRAY_OBJ }
-func (ao *Array) Inspect() string {
-	var out bytes.Buffer
-	elements := []string{}
-	for _, e := range ao.Elements {
-		elements = append(elements, e.Inspect())
+func (ao *Array) Inspect() string  { return inspect(ao, map[Object]bool{}) }
+
+// HashPair keeps the original key alongside its value, so hashes can be
+// printed and iterated
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+type Hash struct {
+	Pairs map[HashKey]HashPair
+}
+
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+
+// Inspect prints the pairs sorted by key, so the output is stable
+func (h *Hash) Inspect() string { return inspect(h, map[Object]bool{}) }
+
+// inspect prints obj. An array or hash that holds itself, directly or
+// through others, is printed as [...] or {...} where it recurs, with seen
+// holding the ones being printed.
+func inspect(obj Object, seen map[Object]bool) string {
+	switch obj := obj.(type) {
+	case *Array:
+		if seen[obj] {
+			return "[...]"
+		}
+		seen[obj] = true
+		defer delete(seen, obj)
+
+		elements := []string{}
+		for _, e := range obj.Elements {
+			elements = append(elements, inspect(e, seen))
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case *Hash:
+		if seen[obj] {
+			return "{...}"
+		}
+		seen[obj] = true
+		defer delete(seen, obj)
+
+		pairs := []string{}
+		for _, pair := range obj.Pairs {
+			pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), inspect(pair.Value, seen)))
+		}
+		sort.Strings(pairs)
+		return "{" + strings.Join(pairs, ", ") + "}"
+	default:
+		return obj.Inspect()
 	}
+}
 
-	out.WriteString("[")
-	out.WriteString(strings.Join(elements, ", "))
-	out.WriteString("]")
+// Keys returns the keys of the hash in a stable order: by type, then by
+// value
+func (h *Hash) Keys() []Object {
+	keys := make([]Object, 0, len(h.Pairs))
+	for _, pair := range h.Pairs {
+		keys = append(keys, pair.Key)
+	}
 
-	return out.String()
+	sort.Slice(keys, func(i, j int) bool { return lessKey(keys[i], keys[j]) })
+
+	return keys
+}
+
+func lessKey(a, b Object) bool {
+	if a.Type() != b.Type() {
+		return a.Type() < b.Type()
+	}
+
+	switch a := a.(type) {
+	case *String:
+		return a.Value < b.(*String).Value
+	case *Float:
+		return a.Value < b.(*Float).Value
+	case *Boolean:
+		return !a.Value && b.(*Boolean).Value
+	}
+
+	x, xok := BigValue(a)
+	y, yok := BigValue(b)
+	if xok && yok {
+		return x.Cmp(y) < 0
+	}
+
+	return a.Inspect() < b.Inspect()
+}
+
+// Iterate returns the values a for loop visits: the elements of an array,
+// the characters of a string or the keys of a hash. It returns false for any
+// other object.
+func Iterate(obj Object) ([]Object, bool) {
+	switch obj := obj.(type) {
+	case *Array:
+		return obj.Elements, true
+	case *String:
+		chars := []Object{}
+		for _, r := range obj.Value {
+			chars = append(chars, &String{Value: string(r)})
+		}
+		return chars, true
+	case *Hash:
+		return obj.Keys(), true
+	default:
+		return nil, false
+	}
+}
+
+// CompiledFunction is a function body compiled to bytecode
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	Name          string // the name given by let, empty for anonymous functions
+	NumLocals     int    // parameters and let bindings, including the rest parameter
+	NumParameters int    // declared parameters, not counting the rest parameter
+	NumRequired   int    // parameters without a default
+	HasRest       bool   // whether extra arguments are collected into an array
+
+	FreeNames []string   // the name of each captured variable, for error messages
+	Positions []Position // where the instructions come from in the source
+
+	Literal *ast.FunctionLiteral // the source of the function, for Inspect
+}
+
+// Position places the instruction at Offset, and those following it up to
+// the next Position, in the source
+type Position struct {
+	Offset int
+	Pos    token.Position
+}
+
+// PositionOf returns where the instruction covering offset comes from
+func (cf *CompiledFunction) PositionOf(offset int) token.Position {
+	i := sort.Search(len(cf.Positions), func(i int) bool {
+		return cf.Positions[i].Offset > offset
+	})
+	if i == 0 {
+		return token.Position{}
+	}
+	return cf.Positions[i-1].Pos
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// Describe names the function for error messages
+func (cf *CompiledFunction) Describe() string {
+	if cf.Name == "" {
+		return "anonymous function"
+	}
+	return "`" + cf.Name + "`"
+}
+
+// Closure is a compiled function together with the free variables it
+// captured when it was created. It is the vm's function value, so it reports
+// the same type as a Function.
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ }
+func (c *Closure) Inspect() string {
+	if fl := c.Fn.Literal; fl != nil {
+		return inspectFunction(fl.Parameters, fl.Defaults, fl.Rest, fl.Body)
+	}
+	return fmt.Sprintf("Closure[%p]", c)
 }
@@ -0,0 +1,263 @@
+// object/object_test.go
+//
+// unit tests for the object system
+
+package object
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"../token"
+)
+
+func TestCompareAndEqual(t *testing.T) {
+	huge := NewBigInteger(new(big.Int).Lsh(big.NewInt(1), 70))
+	loop, other := &Array{Elements: []Object{nil}}, &Array{Elements: []Object{nil}}
+	loop.Elements[0], other.Elements[0] = loop, other
+
+	tests := []struct {
+		a, b    Object
+		compare int
+		ok      bool
+		equal   bool
+	}{
+		{&Integer{Value: 1}, &Integer{Value: 2}, -1, true, false},
+		{&Integer{Value: 2}, &Float{Value: 2}, 0, true, true},
+		{huge, &Integer{Value: math.MaxInt64}, 1, true, false},
+		{&Float{Value: 1e30}, huge, 1, true, false},
+		{&String{Value: "a"}, &String{Value: "b"}, -1, true, false},
+		{&String{Value: "1"}, &Integer{Value: 1}, 0, false, false},
+		{&Float{Value: math.NaN()}, &Float{Value: 1}, 0, false, false},
+		{True, True, 0, false, true},
+		{&Null{}, &Null{}, 0, false, true},
+		{&Array{Elements: []Object{&Integer{Value: 1}}}, &Array{Elements: []Object{&Float{Value: 1}}}, 0, false, true},
+		{&Array{}, &Hash{}, 0, false, false},
+		{loop, other, 0, false, true},
+		{loop, &Array{Elements: []Object{other}}, 0, false, true},
+		{loop, &Array{Elements: []Object{&Integer{Value: 1}}}, 0, false, false},
+	}
+
+	for _, tt := range tests {
+		compare, ok := Compare(tt.a, tt.b)
+		if ok != tt.ok || compare != tt.compare {
+			t.Errorf("Compare(%s, %s) wrong. want=(%d, %t), got=(%d, %t)", tt.a.Inspect(), tt.b.Inspect(), tt.compare, tt.ok, compare, ok)
+		}
+		if equal := Equal(tt.a, tt.b); equal != tt.equal {
+			t.Errorf("Equal(%s, %s) wrong. want=%t, got=%t", tt.a.Inspect(), tt.b.Inspect(), tt.equal, equal)
+		}
+	}
+}
+
+func TestNilBudget(t *testing.T) {
+	var b *Budget
+
+	if err := b.Step(); err != nil {
+		t.Errorf("Step failed: %s", err)
+	}
+	if err := b.CheckContext(); err != nil {
+		t.Errorf("CheckContext failed: %s", err)
+	}
+	if err := b.Track(&String{Value: "abc"}); err != nil {
+		t.Errorf("Track failed: %s", err)
+	}
+	if depth := b.MaxDepth(); depth != DefaultMaxDepth {
+		t.Errorf("wrong MaxDepth. got=%d", depth)
+	}
+}
+
+func TestEnvironmentDeclare(t *testing.T) {
+	yes, no := &Boolean{Value: true}, &Boolean{Value: false}
+
+	env := NewEnvironment()
+	if err := env.Declare("x", yes, true); err != nil {
+		t.Fatalf("Declare returned error: %s", err.Message)
+	}
+	if err := env.Declare("x", no, false); err == nil || err.Message != "cannot redeclare constant: x" {
+		t.Errorf("redeclaring a constant did not fail. got=%v", err)
+	}
+	if err := env.Assign("x", no); err == nil || err.Message != "cannot assign to constant: x" {
+		t.Errorf("assigning to a constant did not fail. got=%v", err)
+	}
+	if err := env.Assign("y", no); err == nil || err.Message != "cannot assign to undeclared identifier: y" {
+		t.Errorf("assigning to an undeclared name did not fail. got=%v", err)
+	}
+
+	if err := env.Declare("y", yes, false); err != nil {
+		t.Fatalf("Declare returned error: %s", err.Message)
+	}
+	if err := env.Declare("y", no, false); err != nil {
+		t.Errorf("redeclaring a let failed: %s", err.Message)
+	}
+
+	env.SetStrict(true)
+	if err := env.Declare("y", yes, false); err == nil || err.Message != "y is already declared in this scope" {
+		t.Errorf("redeclaring in strict mode did not fail. got=%v", err)
+	}
+
+	inner := NewEnclosedEnvironment(env)
+	if err := inner.Declare("y", yes, false); err == nil || err.Message != "y shadows a binding in an enclosing scope" {
+		t.Errorf("shadowing in strict mode did not fail. got=%v", err)
+	}
+	if err := inner.Assign("y", yes); err != nil {
+		t.Errorf("Assign returned error: %s", err.Message)
+	}
+	if val, _ := env.Get("y"); val != yes {
+		t.Errorf("Assign did not update the enclosing scope. got=%v", val)
+	}
+}
+
+func TestIterate(t *testing.T) {
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	for _, key := range []Object{&String{Value: "b"}, &Integer{Value: 10}, &String{Value: "a"}, &Integer{Value: 9}, &Boolean{Value: true}} {
+		hash.Pairs[key.(Hashable).HashKey()] = HashPair{Key: key, Value: key}
+	}
+
+	tests := []struct {
+		iterable Object
+		expected string
+	}{
+		{&Array{Elements: []Object{&Integer{Value: 1}, &Integer{Value: 2}}}, "[1, 2]"},
+		{&String{Value: "héllo"}, "[h, é, l, l, o]"},
+		{hash, "[true, 9, 10, a, b]"},
+	}
+
+	for _, tt := range tests {
+		elements, ok := Iterate(tt.iterable)
+		if !ok {
+			t.Fatalf("cannot iterate over %s", tt.iterable.Type())
+		}
+		if got := (&Array{Elements: elements}).Inspect(); got != tt.expected {
+			t.Errorf("wrong elements. want=%s, got=%s", tt.expected, got)
+		}
+	}
+
+	if _, ok := Iterate(&Integer{Value: 1}); ok {
+		t.Errorf("iterated over an integer")
+	}
+}
+
+func TestThrown(t *testing.T) {
+	caught := &ErrorValue{Err: &Error{
+		Kind:    RUNTIME_ERROR,
+		Message: "bad",
+		Pos:     token.Position{Line: 3, Column: 1},
+		Trace:   []Frame{{Function: "f", Pos: token.Position{Line: 5, Column: 1}}},
+	}}
+
+	rethrown := Thrown(caught)
+	if rethrown == caught.Err {
+		t.Errorf("Thrown returned the caught Error itself")
+	}
+	if rethrown.Message != "bad" || rethrown.Pos.Line != 3 || len(rethrown.Trace) != 1 {
+		t.Errorf("rethrown error lost its details. got=%+v", rethrown)
+	}
+
+	if got := Thrown(&Integer{Value: 42}); got.Message != "42" || got.Kind != RUNTIME_ERROR {
+		t.Errorf("wrong error for thrown integer. got=%+v", got)
+	}
+
+	trace, ok := caught.Field("trace")
+	if !ok || trace.Inspect() != "[in `f` called at 5:1]" {
+		t.Errorf("wrong trace field. got=%v", trace)
+	}
+	if _, ok := caught.Field("stack"); ok {
+		t.Errorf("unknown field found")
+	}
+}
+
+func TestOverflowChecks(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(a, b int64) (int64, bool)
+		a, b int64
+		ok   bool
+	}{
+		{"add", AddInt64, math.MaxInt64, 1, false},
+		{"add", AddInt64, math.MaxInt64, -1, true},
+		{"add", AddInt64, math.MinInt64, -1, false},
+		{"sub", SubInt64, math.MinInt64, 1, false},
+		{"sub", SubInt64, 0, math.MinInt64, false},
+		{"sub", SubInt64, -1, math.MinInt64, true},
+		{"mul", MulInt64, 1 << 32, 1 << 31, false},
+		{"mul", MulInt64, 1 << 31, 1 << 31, true},
+		{"mul", MulInt64, -1, math.MinInt64, false},
+		{"mul", MulInt64, 0, math.MinInt64, true},
+		{"div", DivInt64, math.MinInt64, -1, false},
+		{"div", DivInt64, math.MinInt64, 1, true},
+	}
+
+	for _, tt := range tests {
+		if _, ok := tt.fn(tt.a, tt.b); ok != tt.ok {
+			t.Errorf("%s(%d, %d) ok wrong. expected=%t, got=%t", tt.name, tt.a, tt.b, tt.ok, ok)
+		}
+	}
+}
+
+func TestNewBigInteger(t *testing.T) {
+	small := NewBigInteger(big.NewInt(42))
+	if integer, ok := small.(*Integer); !ok || integer.Value != 42 {
+		t.Errorf("value that fits is not an Integer. got=%T (%+v)", small, small)
+	}
+
+	huge, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+	obj := NewBigInteger(huge)
+	if obj.Type() != INTEGER_OBJ || obj.Inspect() != "-123456789012345678901234567890" {
+		t.Errorf("wrong BigInteger. got=%s %s", obj.Type(), obj.Inspect())
+	}
+
+	negated := NewBigInteger(new(big.Int).Neg(huge)).(*BigInteger)
+	if obj.(*BigInteger).HashKey() == negated.HashKey() {
+		t.Errorf("negated values have the same hash key")
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{3.14, "3.14"},
+		{2, "2.0"},
+		{-0.5, "-0.5"},
+		{1e-9, "1e-09"},
+		{1e21, "1e+21"},
+		{math.Inf(1), "+Inf"},
+	}
+
+	for _, tt := range tests {
+		f := &Float{Value: tt.value}
+		if f.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect output. expected=%q, got=%q", tt.expected, f.Inspect())
+		}
+	}
+}
+
+func TestStringHashKey(t *testing.T) {
+	hello1 := &String{Value: "Hello World"}
+	hello2 := &String{Value: "Hello World"}
+	diff1 := &String{Value: "My name is johnny"}
+	diff2 := &String{Value: "My name is johnny"}
+
+	if hello1.HashKey() != hello2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+
+	if diff1.HashKey() != diff2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+
+	if hello1.HashKey() == diff1.HashKey() {
+		t.Errorf("strings with different content have same hash keys")
+	}
+}
+
+func TestHashKeyTypesDiffer(t *testing.T) {
+	one := &Integer{Value: 1}
+	yes := &Boolean{Value: true}
+
+	if one.HashKey() == yes.HashKey() {
+		t.Errorf("integer 1 and true have the same hash key")
+	}
+}
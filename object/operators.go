@@ -0,0 +1,191 @@
+// object/operators.go
+//
+// definitions for the arithmetic and comparison operators, shared by the
+// evaluator and the vm
+
+package object
+
+import (
+	"math"
+	"math/big"
+)
+
+// Infix applies a binary operator such as + or < to left and right. Values
+// other than numbers and strings can only be compared with == and !=, which
+// compare booleans and null by value and everything else by identity.
+func Infix(operator string, left, right Object) Object {
+	switch {
+	case left.Type() == STRING_OBJ && right.Type() == STRING_OBJ:
+		return stringInfix(operator, left, right)
+	case left.Type() == INTEGER_OBJ && right.Type() == INTEGER_OBJ:
+		return integerInfix(operator, left, right)
+	case isNumber(left) && isNumber(right):
+		return floatInfix(operator, left, right)
+	case operator == "==":
+		return NativeBool(identical(left, right))
+	case operator == "!=":
+		return NativeBool(!identical(left, right))
+	case left.Type() != right.Type():
+		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// Negate applies the prefix - operator
+func Negate(right Object) Object {
+	switch right := right.(type) {
+	case *Integer:
+		if value, ok := NegInt64(right.Value); ok {
+			return &Integer{Value: value}
+		}
+		return NewBigInteger(new(big.Int).Neg(big.NewInt(right.Value)))
+	case *BigInteger:
+		return NewBigInteger(new(big.Int).Neg(right.Value))
+	case *Float:
+		return &Float{Value: -right.Value}
+	default:
+		return newError("unknown operator: -%s", right.Type())
+	}
+}
+
+func stringInfix(operator string, left, right Object) Object {
+	if operator != "+" {
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+
+	return &String{Value: left.(*String).Value + right.(*String).Value}
+}
+
+// integerInfix works on int64 values as long as they fit, switching to big
+// integers when an operand or the result does not
+func integerInfix(operator string, left, right Object) Object {
+	leftInt, leftOk := left.(*Integer)
+	rightInt, rightOk := right.(*Integer)
+	if !leftOk || !rightOk {
+		return bigIntegerInfix(operator, left, right)
+	}
+
+	leftVal := leftInt.Value
+	rightVal := rightInt.Value
+
+	var result int64
+	var ok bool
+
+	switch operator {
+	case "+":
+		result, ok = AddInt64(leftVal, rightVal)
+	case "-":
+		result, ok = SubInt64(leftVal, rightVal)
+	case "*":
+		result, ok = MulInt64(leftVal, rightVal)
+	case "/":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		result, ok = DivInt64(leftVal, rightVal)
+	case "%":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		result, ok = leftVal%rightVal, true
+	case "<":
+		return NativeBool(leftVal < rightVal)
+	case ">":
+		return NativeBool(leftVal > rightVal)
+	case "==":
+		return NativeBool(leftVal == rightVal)
+	case "!=":
+		return NativeBool(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+
+	if !ok {
+		return bigIntegerInfix(operator, left, right)
+	}
+	return &Integer{Value: result}
+}
+
+func bigIntegerInfix(operator string, left, right Object) Object {
+	leftVal, _ := BigValue(left)
+	rightVal, _ := BigValue(right)
+
+	switch operator {
+	case "+":
+		return NewBigInteger(leftVal.Add(leftVal, rightVal))
+	case "-":
+		return NewBigInteger(leftVal.Sub(leftVal, rightVal))
+	case "*":
+		return NewBigInteger(leftVal.Mul(leftVal, rightVal))
+	case "/":
+		if rightVal.Sign() == 0 {
+			return newError("division by zero")
+		}
+		return NewBigInteger(leftVal.Quo(leftVal, rightVal))
+	case "%":
+		if rightVal.Sign() == 0 {
+			return newError("division by zero")
+		}
+		return NewBigInteger(leftVal.Rem(leftVal, rightVal))
+	case "<":
+		return NativeBool(leftVal.Cmp(rightVal) < 0)
+	case ">":
+		return NativeBool(leftVal.Cmp(rightVal) > 0)
+	case "==":
+		return NativeBool(leftVal.Cmp(rightVal) == 0)
+	case "!=":
+		return NativeBool(leftVal.Cmp(rightVal) != 0)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// floatInfix handles two FLOATs or a FLOAT mixed with an INTEGER, which is
+// converted first
+func floatInfix(operator string, left, right Object) Object {
+	leftVal, _ := floatValue(left)
+	rightVal, _ := floatValue(right)
+
+	switch operator {
+	case "+":
+		return &Float{Value: leftVal + rightVal}
+	case "-":
+		return &Float{Value: leftVal - rightVal}
+	case "*":
+		return &Float{Value: leftVal * rightVal}
+	case "/":
+		return &Float{Value: leftVal / rightVal}
+	case "%":
+		return &Float{Value: math.Mod(leftVal, rightVal)}
+	case "<":
+		return NativeBool(leftVal < rightVal)
+	case ">":
+		return NativeBool(leftVal > rightVal)
+	case "==":
+		return NativeBool(leftVal == rightVal)
+	case "!=":
+		return NativeBool(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func isNumber(obj Object) bool {
+	return obj.Type() == INTEGER_OBJ || obj.Type() == FLOAT_OBJ
+}
+
+// identical compares values that are neither numbers nor strings. Each
+// engine has its own null, and host values may bring in others, so booleans
+// and null compare by value.
+func identical(left, right Object) bool {
+	switch left := left.(type) {
+	case *Boolean:
+		r, ok := right.(*Boolean)
+		return ok && left.Value == r.Value
+	case *Null:
+		_, ok := right.(*Null)
+		return ok
+	}
+	return left == right
+}
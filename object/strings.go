@@ -0,0 +1,338 @@
+// object/strings.go
+//
+// definitions for the string builtins and the conversions to strings and
+// booleans
+
+package object
+
+import (
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// stringArg returns args[i] as a string, or an error naming the builtin
+func stringArg(name string, args []Object, i int) (*String, *Error) {
+	str, ok := args[i].(*String)
+	if !ok {
+		return nil, newError("argument to `%s` must be STRING, got %s", name, args[i].Type())
+	}
+	return str, nil
+}
+
+// stringBuiltin wraps a builtin taking strings only, between min and max of
+// them
+func stringBuiltin(name string, min, max int, fn func(args []string) Object) BuiltinFunction {
+	return func(args ...Object) Object {
+		if err := checkArgCount(len(args), min, max); err != nil {
+			return err
+		}
+
+		values := make([]string, len(args))
+		for i := range args {
+			str, err := stringArg(name, args, i)
+			if err != nil {
+				return err
+			}
+			values[i] = str.Value
+		}
+		return fn(values)
+	}
+}
+
+// sequenceBuiltin wraps a builtin that works on both arrays and strings,
+// choosing by its first argument
+func sequenceBuiltin(name string, min, max int, array func(arr *Array, args []Object) Object, str func(s *String, args []Object) Object) BuiltinFunction {
+	return func(args ...Object) Object {
+		if err := checkArgCount(len(args), min, max); err != nil {
+			return err
+		}
+
+		switch arg := args[0].(type) {
+		case *Array:
+			return array(arg, args[1:])
+		case *String:
+			return str(arg, args[1:])
+		default:
+			return newError("argument to `%s` must be ARRAY or STRING, got %s", name, args[0].Type())
+		}
+	}
+}
+
+func checkArgCount(got, min, max int) *Error {
+	switch {
+	case got >= min && got <= max:
+		return nil
+	case min == max:
+		return newError("wrong number of arguments. got=%d, want=%d", got, min)
+	default:
+		return newError("wrong number of arguments. got=%d, want=%d to %d", got, min, max)
+	}
+}
+
+// stringSplit splits around each instance of a separator, or around runs of
+// white space when none is given
+func stringSplit(args []string) Object {
+	var parts []string
+	if len(args) == 1 {
+		parts = strings.Fields(args[0])
+	} else {
+		parts = strings.Split(args[0], args[1])
+	}
+	return stringArray(parts)
+}
+
+// stringTrim wraps a trimming function, which removes white space or, if
+// given, any of a set of characters
+func stringTrim(trim func(s, cutset string) string, trimSpace func(s string) string) func(args []string) Object {
+	return func(args []string) Object {
+		if len(args) == 1 {
+			return &String{Value: trimSpace(args[0])}
+		}
+		return &String{Value: trim(args[0], args[1])}
+	}
+}
+
+func trimLeftSpace(s string) string  { return strings.TrimLeftFunc(s, unicode.IsSpace) }
+func trimRightSpace(s string) string { return strings.TrimRightFunc(s, unicode.IsSpace) }
+
+func stringUpper(args []string) Object { return &String{Value: strings.ToUpper(args[0])} }
+func stringLower(args []string) Object { return &String{Value: strings.ToLower(args[0])} }
+
+func stringStartsWith(args []string) Object { return NativeBool(strings.HasPrefix(args[0], args[1])) }
+func stringEndsWith(args []string) Object   { return NativeBool(strings.HasSuffix(args[0], args[1])) }
+
+// stringReplace replaces every instance of old with new, or only the first n
+// if a count is given
+func stringReplace(args ...Object) Object {
+	if err := checkArgCount(len(args), 3, 4); err != nil {
+		return err
+	}
+
+	var values [3]string
+	for i := range values {
+		str, err := stringArg("replace", args, i)
+		if err != nil {
+			return err
+		}
+		values[i] = str.Value
+	}
+
+	n := -1
+	if len(args) == 4 {
+		count, ok := args[3].(*Integer)
+		if !ok {
+			return newError("count given to `replace` must be INTEGER, got %s", args[3].Type())
+		}
+		n = int(count.Value)
+	}
+	return &String{Value: strings.Replace(values[0], values[1], values[2], n)}
+}
+
+func stringContains(s *String, args []Object) Object {
+	sub, err := stringArg("contains", args, 0)
+	if err != nil {
+		return err
+	}
+	return NativeBool(strings.Contains(s.Value, sub.Value))
+}
+
+// stringIndexOf returns the index of the character starting the first
+// instance of a substring, or -1 if there is none
+func stringIndexOf(s *String, args []Object) Object {
+	sub, err := stringArg("index_of", args, 0)
+	if err != nil {
+		return err
+	}
+
+	i := strings.Index(s.Value, sub.Value)
+	if i < 0 {
+		return &Integer{Value: -1}
+	}
+	return &Integer{Value: int64(utf8.RuneCountInString(s.Value[:i]))}
+}
+
+// stringSlice returns the characters from start up to but not including end,
+// which defaults to the length. Negative bounds count from the end.
+func stringSlice(name string) func(s *String, args []Object) Object {
+	return func(s *String, args []Object) Object {
+		chars := []rune(s.Value)
+		start, end, err := sliceBounds(name, len(chars), args)
+		if err != nil {
+			return err
+		}
+		return &String{Value: string(chars[start:end])}
+	}
+}
+
+// stringSubstring is slice for strings only
+func stringSubstring(args ...Object) Object {
+	if err := checkArgCount(len(args), 2, 3); err != nil {
+		return err
+	}
+
+	str, err := stringArg("substring", args, 0)
+	if err != nil {
+		return err
+	}
+	return stringSlice("substring")(str, args[1:])
+}
+
+func stringRepeat(budget *Budget, args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	str, err := stringArg("repeat", args, 0)
+	if err != nil {
+		return err
+	}
+	count, ok := args[1].(*Integer)
+	if !ok || count.Value < 0 {
+		return newError("count given to `repeat` must be a non-negative INTEGER, got %s", args[1].Inspect())
+	}
+
+	size, ok := repeatedSize(str.Value, count.Value)
+	if !ok {
+		return newError("result of `repeat` is too large")
+	}
+	if err := budget.Reserve(size); err != nil {
+		return err
+	}
+	return &String{Value: strings.Repeat(str.Value, int(count.Value))}
+}
+
+// stringPad pads a string with spaces, or the given character, to width
+// characters. Like printf, a positive width pads on the left and a negative
+// one on the right.
+func stringPad(budget *Budget, args ...Object) Object {
+	if err := checkArgCount(len(args), 2, 3); err != nil {
+		return err
+	}
+
+	str, err := stringArg("pad", args, 0)
+	if err != nil {
+		return err
+	}
+	width, ok := args[1].(*Integer)
+	if !ok {
+		return newError("width given to `pad` must be INTEGER, got %s", args[1].Type())
+	}
+
+	fill := " "
+	if len(args) == 3 {
+		s, ok := args[2].(*String)
+		if !ok || utf8.RuneCountInString(s.Value) != 1 {
+			return newError("fill given to `pad` must be a single character, got %s", args[2].Inspect())
+		}
+		fill = s.Value
+	}
+
+	w := width.Value
+	if w < 0 {
+		w = -w
+	}
+	missing := w - int64(utf8.RuneCountInString(str.Value))
+	if missing <= 0 {
+		return str
+	}
+
+	size, ok := repeatedSize(fill, missing)
+	if !ok || size > math.MaxInt64-int64(len(str.Value)) {
+		return newError("result of `pad` is too large")
+	}
+	if err := budget.Reserve(size + int64(len(str.Value))); err != nil {
+		return err
+	}
+
+	padding := strings.Repeat(fill, int(missing))
+	if width.Value < 0 {
+		return &String{Value: str.Value + padding}
+	}
+	return &String{Value: padding + str.Value}
+}
+
+// stringChars splits a string into its characters
+func stringChars(args []string) Object {
+	chars := []string{}
+	for _, r := range args[0] {
+		chars = append(chars, string(r))
+	}
+	return stringArray(chars)
+}
+
+// stringBytes returns the UTF-8 encoding of a string as integers, for the
+// rare code that needs bytes rather than characters
+func stringBytes(args []string) Object {
+	elements := make([]Object, len(args[0]))
+	for i := 0; i < len(args[0]); i++ {
+		elements[i] = &Integer{Value: int64(args[0][i])}
+	}
+	return &Array{Elements: elements}
+}
+
+func stringArray(values []string) *Array {
+	elements := make([]Object, len(values))
+	for i, value := range values {
+		elements[i] = &String{Value: value}
+	}
+	return &Array{Elements: elements}
+}
+
+// toString returns a string as it is and anything else as it is printed
+func toString(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	if str, ok := args[0].(*String); ok {
+		return str
+	}
+	return &String{Value: args[0].Inspect()}
+}
+
+// toBoolean parses "true" or "false", and converts null and numbers, which
+// are true when they are not zero. It is a conversion rather than a truth
+// test: a condition takes every number and string as true, but bool(0) and
+// bool("false") are false.
+func toBoolean(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *Boolean:
+		return arg
+	case *Null:
+		return False
+	case *String:
+		switch arg.Value {
+		case "true":
+			return True
+		case "false":
+			return False
+		}
+		return newError("could not parse %q as boolean", arg.Value)
+	case *Integer:
+		return NativeBool(arg.Value != 0)
+	case *BigInteger:
+		return True
+	case *Float:
+		return NativeBool(arg.Value != 0)
+	default:
+		return newError("argument to `bool` not supported, got %s", args[0].Type())
+	}
+}
+
+// repeatedSize returns the length in bytes of count copies of s, and false
+// if it does not fit in an int64
+func repeatedSize(s string, count int64) (int64, bool) {
+	if len(s) == 0 {
+		return 0, true
+	}
+	if count > math.MaxInt64/int64(len(s)) {
+		return 0, false
+	}
+	return count * int64(len(s)), true
+}
@@ -6,9 +6,11 @@ package parser
 
 import (
 	"fmt"
+	"math/big"
 	"strconv"
 
 	"../ast"
+	"../diagnostic"
 	"../lexer"
 	"../token"
 )
@@ -16,26 +18,59 @@ import (
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN      // x = y or x += y
 	EQUALS      // ==
 	LESSGREATER // > or <
 	SUM         // +
-	PRODUCT     // *
+	PRODUCT     // * / %
 	PREFIX      // -X or !X
 	CALL        // myFunction(X)
 	INDEX       // array[index]
 )
 
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
+	token.ASSIGN:          ASSIGN,
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN:    ASSIGN,
+	token.PERCENT_ASSIGN:  ASSIGN,
+	token.EQ:              EQUALS,
+	token.NOT_EQ:          EQUALS,
+	token.LT:              LESSGREATER,
+	token.GT:              LESSGREATER,
+	token.PLUS:            SUM,
+	token.MINUS:           SUM,
+	token.SLASH:           PRODUCT,
+	token.ASTERISK:        PRODUCT,
+	token.PERCENT:         PRODUCT,
+	token.LPAREN:          CALL,
+	token.LBRACKET:        INDEX,
+}
+
+// Diagnostic codes reported by the parser
+const (
+	ErrUnexpectedToken = "P0001" // a specific token was expected but another was found
+	ErrNoPrefixParseFn = "P0002" // the token cannot start an expression
+	ErrInvalidInteger  = "P0003" // an integer literal could not be parsed
+	ErrMissingDefault  = "P0004" // a required parameter follows an optional one
+	ErrInvalidFloat    = "P0005" // a float literal could not be parsed
+	ErrMissingHandler  = "P0006" // a try has neither a catch nor a finally
+	ErrOutsideLoop     = "P0007" // a break or continue is not inside a loop
+	ErrInvalidTarget   = "P0008" // the left side of an assignment cannot be assigned to
+)
+
+// statementStarts are the tokens that begin a statement, used to find a safe
+// place to resume after a parse error
+var statementStarts = map[token.TokenType]bool{
+	token.LET:      true,
+	token.CONST:    true,
+	token.RETURN:   true,
+	token.THROW:    true,
+	token.WHILE:    true,
+	token.FOR:      true,
+	token.BREAK:    true,
+	token.CONTINUE: true,
 }
 
 type (
@@ -50,7 +85,12 @@ type Parser struct {
 	curToken  token.Token
 	peekToken token.Token
 
-	errors []string
+	diagnostics []*diagnostic.Diagnostic
+	lexed       int          // number of lexer diagnostics already copied
+	unrecovered int          // number of errors not yet recovered from
+	blockDepth  int          // number of enclosing block statements
+	loopDepth   int          // number of enclosing loops in the current function
+	blockEnd    *token.Token // the '}' of the enclosing block, if consumed by a broken statement
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
@@ -59,34 +99,45 @@ type Parser struct {
 // New creates a new parser
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
-		l:      l,
-		errors: []string{},
+		l:           l,
+		diagnostics: []*diagnostic.Diagnostic{},
 	}
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.STRING_START, p.parseInterpolatedString)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
 	p.registerInfix(token.SLASH, p.parseInfixExpression)
 	p.registerInfix(token.ASTERISK, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.EQ, p.parseInfixExpression)
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.SLASH_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PERCENT_ASSIGN, p.parseAssignExpression)
 
 	// Read two tokens, so curToken and peekToken are both set
 	p.nextToken()
@@ -95,23 +146,119 @@ func New(l *lexer.Lexer) *Parser {
 	return p
 }
 
+// parseAssignExpression parses the value of an assignment at the lowest
+// precedence, so a = b = c assigns c to both
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	exp := &ast.AssignExpression{Token: p.curToken, Target: target, Operator: p.curToken.Literal}
+
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	default:
+		d := p.newDiagnostic(ErrInvalidTarget, p.curToken, "cannot assign to %s", target)
+		d.Hint = "only a variable or an index expression such as a[i] can be assigned to"
+		return nil
+	}
+
+	p.nextToken()
+	exp.Value = p.parseExpression(LOWEST)
+
+	return exp
+}
+
+// parseIndexExpression parses left[index], or a slice such as left[1:3],
+// left[:-1] or left[::2] once a ':' follows the first bound
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+	tok := p.curToken
+
+	var index ast.Expression
+	if !p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		index = p.parseExpression(LOWEST)
+	}
+	if p.peekTokenIs(token.COLON) {
+		return p.parseSliceExpression(tok, left, index)
+	}
+
+	exp := &ast.IndexExpression{Token: tok, Left: left, Index: index}
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	exp.Rbracket = p.curToken
+
+	return exp
+}
+
+// parseSliceExpression parses the rest of a slice from the ':' after its
+// start, which is nil when left out
+func (p *Parser) parseSliceExpression(tok token.Token, left, start ast.Expression) ast.Expression {
+	exp := &ast.SliceExpression{Token: tok, Left: left, Start: start}
 
 	p.nextToken()
-	exp.Index = p.parseExpression(LOWEST)
+	if !p.peekTokenIs(token.COLON) && !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		exp.Stop = p.parseExpression(LOWEST)
+	}
+
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		if !p.peekTokenIs(token.RBRACKET) {
+			p.nextToken()
+			exp.Step = p.parseExpression(LOWEST)
+		}
+	}
 
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
+	exp.Rbracket = p.curToken
 
 	return exp
 }
 
+// parseHashLiteral parses {key: value, ...}. A '{' only reaches the prefix
+// table in expression position, since blocks are parsed directly by the
+// constructs that own them (if, fn), so the two never conflict.
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.curToken}
+
+	// the closing '}' belongs to the hash, not to an enclosing block
+	blockDepth := p.blockDepth
+	p.blockDepth = 0
+	defer func() { p.blockDepth = blockDepth }()
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		key := p.parseExpression(LOWEST)
+
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	hash.Rbrace = p.curToken
+
+	return hash
+}
+
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.curToken}
 
 	array.Elements = p.parseExpressionList(token.RBRACKET)
+	if p.curTokenIs(token.RBRACKET) {
+		array.Rbracket = p.curToken
+	}
 
 	return array
 }
@@ -144,9 +291,37 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+// parseInterpolatedString parses the text and expressions of a string with
+// ${...} interpolations, from its STRING_START token to its STRING_END
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	str := &ast.InterpolatedString{Token: p.curToken}
+
+	for {
+		if p.curToken.Literal != "" {
+			str.Parts = append(str.Parts, &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal})
+		}
+		if p.curTokenIs(token.STRING_END) {
+			str.Close = p.curToken
+			return str
+		}
+
+		p.nextToken()
+		str.Parts = append(str.Parts, p.parseExpression(LOWEST))
+
+		if p.peekTokenIs(token.STRING_PART) {
+			p.nextToken()
+		} else if !p.expectPeek(token.STRING_END) {
+			return nil
+		}
+	}
+}
+
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
 	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	if p.curTokenIs(token.RPAREN) {
+		exp.Rparen = p.curToken
+	}
 	return exp
 }
 
@@ -157,43 +332,130 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
-	lit.Parameters = p.parseFunctionParameters()
+	if !p.parseFunctionParameters(lit) {
+		return nil
+	}
 
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
 
+	// a loop around the function literal does not extend into its body
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
 	lit.Body = p.parseBlockStatement()
+	p.loopDepth = loopDepth
+
+	markTailCalls(lit.Body, true)
 
 	return lit
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-	identifiers := []*ast.Identifier{}
+// markTailCalls flags the calls in tail position of a function body: the
+// value of a return, and the last expression of the body. A block is the
+// body, or a branch of an if in tail position, when last is set. Calls
+// inside a try are never in tail position, since they must run before the
+// handlers do.
+func markTailCalls(block *ast.BlockStatement, last bool) {
+	if block == nil {
+		return
+	}
 
-	if p.peekTokenIs(token.RPAREN) {
-		p.nextToken()
-		return identifiers
+	for i, stmt := range block.Statements {
+		switch stmt := stmt.(type) {
+		case *ast.ReturnStatement:
+			markTailExpression(stmt.ReturnValue)
+		case *ast.ExpressionStatement:
+			if last && i == len(block.Statements)-1 {
+				markTailExpression(stmt.Expression)
+			} else if ie, ok := stmt.Expression.(*ast.IfExpression); ok {
+				markTailCalls(ie.Consequence, false)
+				markTailCalls(ie.Alternative, false)
+			}
+		case *ast.WhileStatement:
+			markTailCalls(stmt.Body, false)
+		case *ast.ForStatement:
+			markTailCalls(stmt.Body, false)
+		}
 	}
+}
 
-	p.nextToken()
+func markTailExpression(exp ast.Expression) {
+	switch exp := exp.(type) {
+	case *ast.CallExpression:
+		exp.Tail = true
+	case *ast.IfExpression:
+		markTailCalls(exp.Consequence, true)
+		markTailCalls(exp.Alternative, true)
+	}
+}
 
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	identifiers = append(identifiers, ident)
+// parseFunctionParameters parses a parameter list such as
+// (a, b = 1, ...rest) into lit. Parameters with a default must come after
+// the required ones, and a rest parameter must come last.
+func (p *Parser) parseFunctionParameters(lit *ast.FunctionLiteral) bool {
+	lit.Parameters = []*ast.Identifier{}
 
-	for p.peekTokenIs(token.COMMA) {
+	if p.peekTokenIs(token.RPAREN) {
 		p.nextToken()
+		return true
+	}
+
+	defaults := []ast.Expression{}
+	hasDefaults := false
+
+	for {
 		p.nextToken()
 
+		if p.curTokenIs(token.ELLIPSIS) {
+			if !p.expectPeek(token.IDENT) {
+				return false
+			}
+			lit.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			break
+		}
+
+		if !p.curTokenIs(token.IDENT) {
+			p.unexpectedToken(p.curToken, token.IDENT)
+			return false
+		}
+
 		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-		identifiers = append(identifiers, ident)
+		var value ast.Expression
+
+		if p.peekTokenIs(token.ASSIGN) {
+			p.nextToken()
+			p.nextToken()
+			value = p.parseExpression(LOWEST)
+			hasDefaults = true
+		} else if hasDefaults {
+			d := p.newDiagnostic(ErrMissingDefault, ident.Token, "parameter %s without a default follows a parameter with a default", ident.Value)
+			d.Hint = fmt.Sprintf("give %s a default value or move it before the optional parameters", ident.Value)
+		}
+
+		lit.Parameters = append(lit.Parameters, ident)
+		defaults = append(defaults, value)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
 	}
 
-	if !p.expectPeek(token.RPAREN) {
-		return nil
+	if hasDefaults {
+		lit.Defaults = defaults
 	}
 
-	return identifiers
+	if !p.peekTokenIs(token.RPAREN) {
+		d := p.unexpectedToken(p.peekToken, token.RPAREN)
+		if lit.Rest != nil {
+			d.Hint = "a rest parameter must be the last parameter"
+		}
+		return false
+	}
+	p.nextToken()
+
+	return true
 }
 
 func (p *Parser) parseIfExpression() ast.Expression {
@@ -229,21 +491,89 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	expression.Block = p.parseBlockStatement()
+
+	if !p.peekTokenIs(token.CATCH) && !p.peekTokenIs(token.FINALLY) {
+		// move onto the offending token, so recovery does not mistake the
+		// try block's '}' for the end of an enclosing block
+		p.nextToken()
+		d := p.newDiagnostic(ErrMissingHandler, p.curToken, "expected catch or finally after try block, got %s", p.curToken.Type)
+		d.Actual = p.curToken.Type
+		d.Hint = "add a catch (e) { ... } or finally { ... } block"
+		return nil
+	}
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LPAREN) {
+			return nil
+		}
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		expression.Parameter = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+		if !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		expression.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		expression.Finally = p.parseBlockStatement()
+	}
+
+	return expression
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
 
 	p.nextToken()
 
+	p.blockDepth++
+	defer func() { p.blockDepth-- }()
+
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
 		stmt := p.parseStatement()
 
 		if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
+		if p.blockEnd != nil {
+			block.Rbrace = *p.blockEnd
+			p.blockEnd = nil
+			return block
+		}
 		p.nextToken()
 	}
 
+	if p.curTokenIs(token.RBRACE) {
+		block.Rbrace = p.curToken
+	} else {
+		d := p.unexpectedToken(p.curToken, token.RBRACE)
+		d.Hint = fmt.Sprintf("the block opened at %s is never closed", block.Token.Pos)
+	}
+
 	return block
 }
 
@@ -292,6 +622,11 @@ func (p *Parser) parseIdentifier() ast.Expression {
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+
+	if diags := p.l.Diagnostics(); len(diags) > p.lexed {
+		p.diagnostics = append(p.diagnostics, diags[p.lexed:]...)
+		p.lexed = len(diags)
+	}
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
@@ -303,18 +638,92 @@ func (p *Parser) ParseProgram() *ast.Program {
 		if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
+		p.blockEnd = nil
 		p.nextToken()
 	}
 
 	return program
 }
 
+// parseStatement parses a single statement. If that reports new errors the
+// parser skips ahead to the end of the statement and returns an
+// ast.BadStatement covering the skipped tokens, so that one mistake does not
+// cascade into errors for the rest of the input.
 func (p *Parser) parseStatement() ast.Statement {
+	start := p.curToken
+	unrecovered := p.unrecovered
+
+	stmt := p.parseStatementByType()
+
+	if p.unrecovered == unrecovered {
+		return stmt
+	}
+
+	p.synchronize()
+	p.unrecovered = unrecovered
+
+	return &ast.BadStatement{Token: start, Last: p.curToken}
+}
+
+// synchronize advances until the current token ends the broken statement: a
+// ';', or the token before a '}' or a statement keyword. Braces opened along
+// the way are skipped as a unit. If the current token is already the '}' of
+// the enclosing block, it is recorded in blockEnd so the block stops there.
+func (p *Parser) synchronize() {
+	if p.blockEnd != nil {
+		return
+	}
+
+	depth := 0
+
+	for !p.curTokenIs(token.EOF) {
+		switch p.curToken.Type {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			if depth == 0 {
+				p.markBlockEnd()
+				return
+			}
+			depth--
+		case token.SEMICOLON:
+			if depth == 0 {
+				return
+			}
+		}
+
+		if depth == 0 && (p.peekTokenIs(token.RBRACE) || p.peekTokenIs(token.EOF) || statementStarts[p.peekToken.Type]) {
+			return
+		}
+
+		p.nextToken()
+	}
+}
+
+// markBlockEnd records the current '}' as the end of the enclosing block
+func (p *Parser) markBlockEnd() {
+	if p.blockDepth > 0 && p.curTokenIs(token.RBRACE) {
+		tok := p.curToken
+		p.blockEnd = &tok
+	}
+}
+
+func (p *Parser) parseStatementByType() ast.Statement {
 	switch p.curToken.Type {
-	case token.LET:
+	case token.LET, token.CONST:
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.FOR:
+		return p.parseForStatement()
+	case token.BREAK:
+		return p.parseBreakStatement()
+	case token.CONTINUE:
+		return p.parseContinueStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -333,15 +742,25 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	d := p.newDiagnostic(ErrNoPrefixParseFn, p.curToken, "no prefix parse function for %s found", t)
+	d.Actual = t
+
+	switch t {
+	case token.EOF:
+		d.Hint = "the input ended in the middle of an expression"
+	case token.ILLEGAL:
+		d.Hint = fmt.Sprintf("%q is not a valid character here", p.curToken.Literal)
+	default:
+		d.Hint = fmt.Sprintf("%q cannot start an expression", p.curToken.Literal)
+	}
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	prefix := p.prefixParseFns[p.curToken.Type]
 	if prefix == nil {
 		p.noPrefixParseFnError(p.curToken.Type)
-		return nil
+		p.markBlockEnd()
+		return &ast.BadExpression{Token: p.curToken}
 	}
 	leftExp := prefix()
 
@@ -363,9 +782,27 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	if err == nil {
+		lit.Value = value
+		return lit
+	}
+
+	// too large for 64 bits, keep the exact value
+	bigValue, ok := new(big.Int).SetString(p.curToken.Literal, 0)
+	if !ok {
+		p.newDiagnostic(ErrInvalidInteger, p.curToken, "could not parse %q as integer", p.curToken.Literal)
+		return nil
+	}
+	lit.Big = bigValue
+	return lit
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.curToken}
+
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.newDiagnostic(ErrInvalidFloat, p.curToken, "could not parse %q as float", p.curToken.Literal)
 		return nil
 	}
 	lit.Value = value
@@ -389,6 +826,10 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	stmt.Value = p.parseExpression(LOWEST)
 
+	if fn, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		fn.Name = stmt.Name.Value
+	}
+
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
@@ -410,6 +851,123 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseWhileStatement() *ast.WhileStatement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseForStatement() *ast.ForStatement {
+	stmt := &ast.ForStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Variable = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth++
+	defer func() { p.loopDepth-- }()
+
+	return p.parseBlockStatement()
+}
+
+func (p *Parser) parseBreakStatement() *ast.BreakStatement {
+	stmt := &ast.BreakStatement{Token: p.curToken}
+	p.checkInsideLoop()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseContinueStatement() *ast.ContinueStatement {
+	stmt := &ast.ContinueStatement{Token: p.curToken}
+	p.checkInsideLoop()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// checkInsideLoop reports the current break or continue if there is no loop
+// for it to leave
+func (p *Parser) checkInsideLoop() {
+	if p.loopDepth > 0 {
+		return
+	}
+
+	d := p.newDiagnostic(ErrOutsideLoop, p.curToken, "%s outside of a loop", p.curToken.Literal)
+	d.Hint = "break and continue only work inside a while or for loop, and not from a function called by one"
+}
+
 func (p *Parser) curTokenIs(t token.TokenType) bool {
 	return p.curToken.Type == t
 }
@@ -427,14 +985,56 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 	return false
 }
 
-// Errors returns a slice of the errors
+// Errors returns the diagnostics formatted as one line strings
 func (p *Parser) Errors() []string {
-	return p.errors
+	errors := make([]string, 0, len(p.diagnostics))
+	for _, d := range p.diagnostics {
+		errors = append(errors, d.Error())
+	}
+	return errors
+}
+
+// Diagnostics returns every diagnostic reported while parsing
+func (p *Parser) Diagnostics() []*diagnostic.Diagnostic {
+	return p.diagnostics
+}
+
+// newDiagnostic records an error spanning tok
+func (p *Parser) newDiagnostic(code string, tok token.Token, format string, a ...interface{}) *diagnostic.Diagnostic {
+	d := &diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Code:     code,
+		Message:  fmt.Sprintf(format, a...),
+		Pos:      tok.Pos,
+		End:      tok.End,
+	}
+	p.diagnostics = append(p.diagnostics, d)
+	if d.Severity == diagnostic.Error {
+		p.unrecovered++
+	}
+	return d
 }
 
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.unexpectedToken(p.peekToken, t)
+}
+
+// unexpectedToken reports that tok was found where t was expected
+func (p *Parser) unexpectedToken(tok token.Token, t token.TokenType) *diagnostic.Diagnostic {
+	d := p.newDiagnostic(ErrUnexpectedToken, tok, "expected next token to be %s, got %s instead", t, tok.Type)
+	d.Expected = t
+	d.Actual = tok.Type
+
+	switch t {
+	case token.RPAREN, token.RBRACE, token.RBRACKET:
+		d.Hint = fmt.Sprintf("check for a missing %q", string(t))
+	case token.IDENT:
+		d.Hint = "a name is required here"
+	case token.STRING_END:
+		d.Hint = "an interpolation holds a single expression, ended by }"
+	}
+
+	return d
 }
 
 func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
@@ -9,9 +9,690 @@ import (
 	"testing"
 
 	"../ast"
+	"../diagnostic"
 	"../lexer"
+	"../token"
 )
 
+func TestSliceExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a[1:3]", "(a[1:3])"},
+		{"a[:-1]", "(a[:(-1)])"},
+		{"a[1:]", "(a[1:])"},
+		{"a[:]", "(a[:])"},
+		{"a[::2]", "(a[::2])"},
+		{"a[1 + 1:n:-1]", "(a[(1 + 1):n:(-1)])"},
+		{"a[::]", "(a[:])"},
+		{"a[1:2][0]", "((a[1:2])[0])"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		if stmt.Expression.String() != tt.expected {
+			t.Errorf("wrong slice for %q. want=%q, got=%q", tt.input, tt.expected, stmt.Expression.String())
+		}
+		if stmt.Expression.End().Column != len(tt.input)+1 {
+			t.Errorf("wrong end for %q. got=%s", tt.input, stmt.Expression.End())
+		}
+	}
+
+	p := New(lexer.New("a[1:2:3:4]"))
+	p.ParseProgram()
+	if len(p.Diagnostics()) == 0 || p.Diagnostics()[0].Code != ErrUnexpectedToken {
+		t.Errorf("expected an unexpected token error. got=%v", p.Diagnostics())
+	}
+}
+
+func TestInterpolatedString(t *testing.T) {
+	input := `"Hello ${name}, you have ${len(items) + 1}${"!"}"`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	str, ok := stmt.Expression.(*ast.InterpolatedString)
+	if !ok {
+		t.Fatalf("exp not *ast.InterpolatedString. got=%T", stmt.Expression)
+	}
+
+	expected := []string{"Hello ", "name", ", you have ", "(len(items) + 1)", "!"}
+	if len(str.Parts) != len(expected) {
+		t.Fatalf("wrong number of parts. want=%d, got=%d", len(expected), len(str.Parts))
+	}
+	for i, part := range str.Parts {
+		if part.String() != expected[i] {
+			t.Errorf("parts[%d] wrong. want=%q, got=%q", i, expected[i], part.String())
+		}
+	}
+	if _, ok := str.Parts[4].(*ast.StringLiteral); !ok {
+		t.Errorf("parts[4] not *ast.StringLiteral. got=%T", str.Parts[4])
+	}
+
+	if str.String() != "Hello ${name}, you have ${(len(items) + 1)}!" {
+		t.Errorf("str.String() wrong. got=%q", str.String())
+	}
+	if str.Pos().Column != 1 || str.End().Column != len(input)+1 {
+		t.Errorf("wrong span. got=%s to %s", str.Pos(), str.End())
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	input := `fn(n) {
+	a();
+	if (n) { return b() + c() };
+	try { return d() } catch (e) { e };
+	while (n) { e(); return f() };
+	if (n) { g() } else { h() }
+}`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	tail := map[string]bool{}
+	var visit func(node ast.Node)
+	visit = func(node ast.Node) {
+		switch node := node.(type) {
+		case *ast.CallExpression:
+			tail[node.Function.String()] = node.Tail
+		case *ast.ExpressionStatement:
+			visit(node.Expression)
+		case *ast.ReturnStatement:
+			visit(node.ReturnValue)
+		case *ast.InfixExpression:
+			visit(node.Left)
+			visit(node.Right)
+		case *ast.FunctionLiteral:
+			visit(node.Body)
+		case *ast.IfExpression:
+			visit(node.Consequence)
+			if node.Alternative != nil {
+				visit(node.Alternative)
+			}
+		case *ast.TryExpression:
+			visit(node.Block)
+		case *ast.WhileStatement:
+			visit(node.Body)
+		case *ast.BlockStatement:
+			for _, stmt := range node.Statements {
+				visit(stmt)
+			}
+		}
+	}
+	visit(program.Statements[0])
+
+	expected := map[string]bool{"a": false, "b": false, "c": false, "d": false, "e": false, "f": true, "g": true, "h": true}
+	if len(tail) != len(expected) {
+		t.Fatalf("wrong number of calls. want=%d, got=%d", len(expected), len(tail))
+	}
+	for name, want := range expected {
+		if tail[name] != want {
+			t.Errorf("wrong Tail for call to %s. want=%t, got=%t", name, want, tail[name])
+		}
+	}
+}
+
+func TestConstStatement(t *testing.T) {
+	l := lexer.New("const limit = 10;")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.LetStatement. got=%T", program.Statements[0])
+	}
+	if !stmt.IsConst() {
+		t.Errorf("stmt.IsConst() is false")
+	}
+	if stmt.Name.Value != "limit" {
+		t.Errorf("stmt.Name.Value not 'limit'. got=%q", stmt.Name.Value)
+	}
+	if stmt.String() != "const limit = 10;" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+}
+
+func TestAssignExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		operator string
+		str      string
+	}{
+		{"x = 5", "=", "x = 5"},
+		{"x += y * 2", "+=", "x += (y * 2)"},
+		{"a[i] %= 3", "%=", "(a[i]) %= 3"},
+		{"a = b = c", "=", "a = b = c"},
+		{"x = y == z", "=", "x = (y == z)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		exp, ok := stmt.Expression.(*ast.AssignExpression)
+		if !ok {
+			t.Fatalf("exp not *ast.AssignExpression. got=%T", stmt.Expression)
+		}
+		if exp.Operator != tt.operator {
+			t.Errorf("exp.Operator wrong. want=%q, got=%q", tt.operator, exp.Operator)
+		}
+		if exp.String() != tt.str {
+			t.Errorf("exp.String() wrong. want=%q, got=%q", tt.str, exp.String())
+		}
+	}
+}
+
+func TestLoopStatements(t *testing.T) {
+	tests := []struct {
+		input string
+		str   string
+	}{
+		{"while (x < 10) { x }", "while (x < 10) x"},
+		{"for (x in xs) { break; }", "for (x in xs) break;"},
+		{"while (true) { for (c in \"ab\") { continue } };", "while true for (c in ab) continue;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+		}
+		if program.String() != tt.str {
+			t.Errorf("program.String() wrong. want=%q, got=%q", tt.str, program.String())
+		}
+	}
+
+	program := New(lexer.New("for (item in items) { item }")).ParseProgram()
+	stmt, ok := program.Statements[0].(*ast.ForStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.ForStatement. got=%T", program.Statements[0])
+	}
+	if !testIdentifier(t, stmt.Variable, "item") || !testIdentifier(t, stmt.Iterable, "items") {
+		return
+	}
+}
+
+func TestTryExpression(t *testing.T) {
+	tests := []struct {
+		input      string
+		parameter  string
+		hasCatch   bool
+		hasFinally bool
+		str        string
+	}{
+		{"try { a } catch (e) { b }", "e", true, false, "try a catch (e) b"},
+		{"try { a } finally { c }", "", false, true, "try a finally c"},
+		{"try { a } catch (err) { b } finally { c }", "err", true, true, "try a catch (err) b finally c"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		exp, ok := stmt.Expression.(*ast.TryExpression)
+		if !ok {
+			t.Fatalf("exp not *ast.TryExpression. got=%T", stmt.Expression)
+		}
+		if (exp.Catch != nil) != tt.hasCatch || (exp.Finally != nil) != tt.hasFinally {
+			t.Errorf("wrong blocks for %q. catch=%v, finally=%v", tt.input, exp.Catch != nil, exp.Finally != nil)
+		}
+		if tt.hasCatch && !testIdentifier(t, exp.Parameter, tt.parameter) {
+			return
+		}
+		if exp.String() != tt.str {
+			t.Errorf("exp.String() wrong. want=%q, got=%q", tt.str, exp.String())
+		}
+	}
+}
+
+func TestThrowStatement(t *testing.T) {
+	l := lexer.New(`throw "bad"; 1`)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ThrowStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.ThrowStatement. got=%T", program.Statements[0])
+	}
+	if stmt.String() != `throw bad;` {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+}
+
+func TestBigIntegerLiteral(t *testing.T) {
+	input := "123456789012345678901234567890;"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.IntegerLiteral. got=%T", stmt.Expression)
+	}
+	if literal.Big == nil || literal.Big.String() != "123456789012345678901234567890" {
+		t.Errorf("literal.Big wrong. got=%v", literal.Big)
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+		str      string
+	}{
+		{"3.14;", 3.14, "3.14"},
+		{"1e-9", 1e-9, "1e-9"},
+		{"-2.5", 2.5, "(-2.5)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.str {
+			t.Errorf("wrong program for %q. got=%q", tt.input, program.String())
+		}
+
+		exp := program.Statements[0].(*ast.ExpressionStatement).Expression
+		if prefix, ok := exp.(*ast.PrefixExpression); ok {
+			exp = prefix.Right
+		}
+
+		literal, ok := exp.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.FloatLiteral. got=%T", exp)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %g. got=%g", tt.expected, literal.Value)
+		}
+	}
+}
+
+func TestCommentsAreTrivia(t *testing.T) {
+	input := `// doubles x
+let double = fn(x) { x * 2 /* cheap */ };`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+
+	stmt := program.Statements[0].(*ast.LetStatement)
+	if len(stmt.Token.Comments) != 1 || stmt.Token.Comments[0].Text != "// doubles x" {
+		t.Errorf("wrong comments on let. got=%+v", stmt.Token.Comments)
+	}
+
+	fn := stmt.Value.(*ast.FunctionLiteral)
+	if len(fn.Body.Rbrace.Comments) != 1 || fn.Body.Rbrace.Comments[0].Text != "/* cheap */" {
+		t.Errorf("wrong comments on '}'. got=%+v", fn.Body.Rbrace.Comments)
+	}
+}
+
+func TestParsingHashLiteralsStringKeys(t *testing.T) {
+	input := `{"one": 1, "two": 2, "three": 3}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(hash.Pairs) != 3 {
+		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+
+	expected := []struct {
+		key   string
+		value int64
+	}{
+		{"one", 1},
+		{"two", 2},
+		{"three", 3},
+	}
+
+	for i, pair := range hash.Pairs {
+		literal, ok := pair.Key.(*ast.StringLiteral)
+		if !ok {
+			t.Errorf("key is not ast.StringLiteral. got=%T", pair.Key)
+			continue
+		}
+		if literal.String() != expected[i].key {
+			t.Errorf("pair %d has wrong key. expected=%q, got=%q", i, expected[i].key, literal.String())
+		}
+
+		testIntegerLiteral(t, pair.Value, expected[i].value)
+	}
+}
+
+func TestParsingEmptyHashLiteral(t *testing.T) {
+	input := "{}"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(hash.Pairs) != 0 {
+		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+}
+
+func TestParsingHashLiteralsWithExpressions(t *testing.T) {
+	input := `{"one": 0 + 1, "two": 10 - 8, "three": 15 / 5}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(hash.Pairs) != 3 {
+		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+
+	tests := map[string]func(ast.Expression){
+		"one": func(e ast.Expression) {
+			testInfixExpression(t, e, 0, "+", 1)
+		},
+		"two": func(e ast.Expression) {
+			testInfixExpression(t, e, 10, "-", 8)
+		},
+		"three": func(e ast.Expression) {
+			testInfixExpression(t, e, 15, "/", 5)
+		},
+	}
+
+	for _, pair := range hash.Pairs {
+		literal, ok := pair.Key.(*ast.StringLiteral)
+		if !ok {
+			t.Errorf("key is not ast.StringLiteral. got=%T", pair.Key)
+			continue
+		}
+
+		testFunc, ok := tests[literal.String()]
+		if !ok {
+			t.Errorf("No test function for key %q found", literal.String())
+			continue
+		}
+
+		testFunc(pair.Value)
+	}
+}
+
+func TestHashLiteralInsideBlock(t *testing.T) {
+	input := `fn() { let h = {"a": 1}; h }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if len(fn.Body.Statements) != 2 {
+		t.Fatalf("body has wrong number of statements. got=%d", len(fn.Body.Statements))
+	}
+
+	let := fn.Body.Statements[0].(*ast.LetStatement)
+	if _, ok := let.Value.(*ast.HashLiteral); !ok {
+		t.Fatalf("let value is not ast.HashLiteral. got=%T", let.Value)
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedErrors     []string
+		expectedStatements []string
+	}{
+		{
+			"if (x { 1 }; let y = 2;",
+			[]string{"1:7: error[P0001]: expected next token to be ), got { instead"},
+			[]string{"*ast.BadStatement", "*ast.LetStatement"},
+		},
+		{
+			"let a = add(1, 2;\nlet = 5;\nlet c = 3;",
+			[]string{
+				"1:17: error[P0001]: expected next token to be ), got ; instead",
+				"2:5: error[P0001]: expected next token to be IDENT, got = instead",
+			},
+			[]string{"*ast.BadStatement", "*ast.BadStatement", "*ast.LetStatement"},
+		},
+		{
+			"let f = fn() { let x = ); x }; f();",
+			[]string{"1:24: error[P0002]: no prefix parse function for ) found"},
+			[]string{"*ast.LetStatement", "*ast.ExpressionStatement"},
+		},
+		{
+			"let f = fn() { let x = }; f();",
+			[]string{"1:24: error[P0002]: no prefix parse function for } found"},
+			[]string{"*ast.LetStatement", "*ast.ExpressionStatement"},
+		},
+		{
+			"let f = fn() { 1;",
+			[]string{"1:18: error[P0001]: expected next token to be }, got EOF instead"},
+			[]string{"*ast.BadStatement"},
+		},
+		{
+			"} 5;",
+			[]string{"1:1: error[P0002]: no prefix parse function for } found"},
+			[]string{"*ast.BadStatement", "*ast.ExpressionStatement"},
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != len(tt.expectedErrors) {
+			t.Errorf("wrong number of errors for %q. expected=%d, got=%d (%q)", tt.input, len(tt.expectedErrors), len(errors), errors)
+			continue
+		}
+		for i, msg := range tt.expectedErrors {
+			if errors[i] != msg {
+				t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, msg, errors[i])
+			}
+		}
+
+		if len(program.Statements) != len(tt.expectedStatements) {
+			t.Errorf("wrong number of statements for %q. expected=%d, got=%d", tt.input, len(tt.expectedStatements), len(program.Statements))
+			continue
+		}
+		for i, typ := range tt.expectedStatements {
+			if got := fmt.Sprintf("%T", program.Statements[i]); got != typ {
+				t.Errorf("wrong statement type for %q at %d. expected=%s, got=%s", tt.input, i, typ, got)
+			}
+		}
+	}
+}
+
+func TestBadStatementInBlock(t *testing.T) {
+	input := "let f = fn() { let = 1; 2 };"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 1 {
+		t.Fatalf("expected 1 error, got=%q", p.Errors())
+	}
+
+	fn := program.Statements[0].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	if len(fn.Body.Statements) != 2 {
+		t.Fatalf("body has wrong number of statements. got=%d", len(fn.Body.Statements))
+	}
+
+	bad, ok := fn.Body.Statements[0].(*ast.BadStatement)
+	if !ok {
+		t.Fatalf("body.Statements[0] is not *ast.BadStatement. got=%T", fn.Body.Statements[0])
+	}
+	if bad.Pos().Column != 16 || bad.End().Column != 24 {
+		t.Errorf("bad statement span wrong. got=%s-%s", bad.Pos(), bad.End())
+	}
+
+	if !testIntegerLiteral(t, fn.Body.Statements[1].(*ast.ExpressionStatement).Expression, 2) {
+		return
+	}
+}
+
+func TestNodePositions(t *testing.T) {
+	input := `let add = fn(a, b) {
+  a + b;
+};
+add(1, [2, 3][0]);`
+
+	l := lexer.NewFile("test.mk", input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	tests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{program, "test.mk:1:1-test.mk:4:18"},
+		{program.Statements[0], "test.mk:1:1-test.mk:3:2"},
+		{program.Statements[0].(*ast.LetStatement).Value, "test.mk:1:11-test.mk:3:2"},
+		{program.Statements[1], "test.mk:4:1-test.mk:4:18"},
+		{program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.CallExpression).Arguments[1], "test.mk:4:8-test.mk:4:17"},
+	}
+
+	for i, tt := range tests {
+		span := tt.node.Pos().String() + "-" + tt.node.End().String()
+		if span != tt.expected {
+			t.Errorf("tests[%d] - span wrong for %q. expected=%q, got=%q", i, tt.node.String(), tt.expected, span)
+		}
+	}
+
+	body := program.Statements[0].(*ast.LetStatement).Value.(*ast.FunctionLiteral).Body
+	infix := body.Statements[0].(*ast.ExpressionStatement).Expression
+	if infix.Pos().Line != 2 || infix.Pos().Column != 3 || infix.End().Column != 8 {
+		t.Errorf("infix span wrong. got=%s-%s", infix.Pos(), infix.End())
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	input := "let x = 1;\nlet = 2;"
+
+	l := lexer.NewFile("test.mk", input)
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors, got none")
+	}
+
+	expected := "test.mk:2:5: error[P0001]: expected next token to be IDENT, got = instead"
+	if errors[0] != expected {
+		t.Errorf("wrong error. expected=%q, got=%q", expected, errors[0])
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedCode     string
+		expectedLine     int
+		expectedColumn   int
+		expectedExpected token.TokenType
+		expectedActual   token.TokenType
+	}{
+		{"add(1, 2;", ErrUnexpectedToken, 1, 9, token.RPAREN, token.SEMICOLON},
+		{"let = 5;", ErrUnexpectedToken, 1, 5, token.IDENT, token.ASSIGN},
+		{"let x = );", ErrNoPrefixParseFn, 1, 9, "", token.RPAREN},
+		{"09", ErrInvalidInteger, 1, 1, "", ""},
+		{"1e999", ErrInvalidFloat, 1, 1, "", ""},
+		{"let x = 1; /* open", lexer.ErrUnterminatedComment, 1, 12, "", ""},
+		{`let s = "a\`, lexer.ErrUnterminatedString, 1, 9, "", ""},
+		{`let s = """a\`, lexer.ErrUnterminatedString, 1, 9, "", ""},
+		{`let s = "x ${1} a\`, lexer.ErrUnterminatedString, 1, 9, "", ""},
+		{"try { 1 } 2", ErrMissingHandler, 1, 11, "", token.INT},
+		{"break;", ErrOutsideLoop, 1, 1, "", ""},
+		{"x + 1 = 2", ErrInvalidTarget, 1, 7, "", ""},
+		{"while (true) { fn() { continue } }", ErrOutsideLoop, 1, 23, "", ""},
+		{`"${a b}"`, ErrUnexpectedToken, 1, 6, token.STRING_END, token.IDENT},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		diags := p.Diagnostics()
+		if len(diags) == 0 {
+			t.Errorf("no diagnostics for %q", tt.input)
+			continue
+		}
+
+		d := diags[0]
+		if d.Severity != diagnostic.Error {
+			t.Errorf("wrong severity for %q. got=%s", tt.input, d.Severity)
+		}
+		if d.Code != tt.expectedCode {
+			t.Errorf("wrong code for %q. expected=%s, got=%s", tt.input, tt.expectedCode, d.Code)
+		}
+		if d.Pos.Line != tt.expectedLine || d.Pos.Column != tt.expectedColumn {
+			t.Errorf("wrong position for %q. expected=%d:%d, got=%s", tt.input, tt.expectedLine, tt.expectedColumn, d.Pos)
+		}
+		if d.Expected != tt.expectedExpected {
+			t.Errorf("wrong expected token for %q. expected=%q, got=%q", tt.input, tt.expectedExpected, d.Expected)
+		}
+		if d.Actual != tt.expectedActual {
+			t.Errorf("wrong actual token for %q. expected=%q, got=%q", tt.input, tt.expectedActual, d.Actual)
+		}
+	}
+}
+
 func TestParsingIndexExpressions(t *testing.T) {
 	input := "myArray[1 + 1]"
 
@@ -165,6 +846,70 @@ func TestFunctionParaemeterParsing(t *testing.T) {
 		}
 	}
 }
+func TestFunctionParameterDefaultsAndRest(t *testing.T) {
+	input := "fn(a, b = 1 + 2, ...rest) { a }"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	function := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+
+	if len(function.Parameters) != 2 {
+		t.Fatalf("wrong number of parameters. got=%d", len(function.Parameters))
+	}
+	testLiteralExpression(t, function.Parameters[0], "a")
+	testLiteralExpression(t, function.Parameters[1], "b")
+
+	if len(function.Defaults) != 2 || function.Defaults[0] != nil {
+		t.Fatalf("wrong defaults. got=%v", function.Defaults)
+	}
+	testInfixExpression(t, function.Defaults[1], 1, "+", 2)
+
+	if function.Rest == nil || function.Rest.Value != "rest" {
+		t.Fatalf("wrong rest parameter. got=%v", function.Rest)
+	}
+
+	if function.String() != "fn(a, b = (1 + 2), ...rest) a" {
+		t.Errorf("function.String() wrong. got=%q", function.String())
+	}
+}
+
+func TestFunctionParameterErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"fn(a = 1, b) { a }", "1:11: error[P0004]: parameter b without a default follows a parameter with a default"},
+		{"fn(...rest, a) { a }", "1:11: error[P0001]: expected next token to be ), got , instead"},
+		{"fn(1) { 1 }", "1:4: error[P0001]: expected next token to be IDENT, got INT instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expectedError {
+			t.Errorf("wrong errors for %q. expected=%q, got=%q", tt.input, tt.expectedError, errors)
+		}
+	}
+}
+
+func TestLetNamesFunctionLiteral(t *testing.T) {
+	l := lexer.New("let add = fn(a, b) { a + b };")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	function := program.Statements[0].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	if function.Name != "add" {
+		t.Errorf("function.Name wrong. want=%q, got=%q", "add", function.Name)
+	}
+}
+
 func TestFunctionLiteralParsing(t *testing.T) {
 	input := `fn(x, y) { x + y; }`
 
@@ -337,6 +1082,10 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"a * b / c",
 			"((a * b) / c)",
 		},
+		{
+			"a + b % c * d",
+			"(a + ((b % c) * d))",
+		},
 		{
 			"a + b / c",
 			"(a + (b / c))",
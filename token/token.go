@@ -4,13 +4,51 @@
 
 package token
 
+import "fmt"
+
 // TokenType allows any string value to be used as a token type, for better perf should use an int
 type TokenType string
 
+// Position is a location in the source text
+type Position struct {
+	Filename string // name of the source file, if any
+	Offset   int    // byte offset, starting at 0
+	Line     int    // line number, starting at 1
+	Column   int    // column number in characters, starting at 1
+}
+
+// IsValid reports whether the position was set by the lexer
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+// String formats the position as file:line:column
+func (p Position) String() string {
+	s := p.Filename
+	if p.IsValid() {
+		if s != "" {
+			s += ":"
+		}
+		s += fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	if s == "" {
+		s = "-"
+	}
+	return s
+}
+
+// Comment is a // or /* */ comment, kept as trivia on the token after it
+type Comment struct {
+	Text string   // the comment including its delimiters
+	Pos  Position // position of the first character of the comment
+	End  Position // position immediately after the comment
+}
+
 // Token maps the token type to the lexical text
 type Token struct {
-	Type    TokenType
-	Literal string
+	Type     TokenType
+	Literal  string
+	Pos      Position  // position of the first character of the token
+	End      Position  // position immediately after the token
+	Comments []Comment // comments between the previous token and this one
 }
 
 // Token codes
@@ -21,6 +59,7 @@ const (
 	// Identifiers and literals
 	IDENT = "IDENT" // add, foobar, x, y, ...
 	INT   = "INT"   // 1343456
+	FLOAT = "FLOAT" // 3.14, 1e-9
 
 	// Operators
 	ASSIGN   = "="
@@ -29,14 +68,24 @@ const (
 	BANG     = "!"
 	ASTERISK = "*"
 	SLASH    = "/"
+	PERCENT  = "%"
 	GT       = ">"
 	LT       = "<"
 	EQ       = "=="
 	NOT_EQ   = "!="
 
+	// Compound assignment operators
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
+	PERCENT_ASSIGN  = "%="
+
 	// Delimiters
 	COMMA     = ","
 	SEMICOLON = ";"
+	COLON     = ":"
+	ELLIPSIS  = "..."
 
 	LPAREN   = "("
 	RPAREN   = ")"
@@ -48,22 +97,49 @@ const (
 	// Keywords
 	FUNCTION = "FUNCTION"
 	LET      = "LET"
+	CONST    = "CONST"
 	IF       = "IF"
 	ELSE     = "ELSE"
 	TRUE     = "TRUE"
 	FALSE    = "FALSE"
 	RETURN   = "RETURN"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
+	THROW    = "THROW"
+	WHILE    = "WHILE"
+	FOR      = "FOR"
+	IN       = "IN"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
 	STRING   = "STRING"
+
+	// A string with ${...} interpolations is split into the text before the
+	// first one, the text between them and the text after the last one, with
+	// the tokens of each interpolated expression in between
+	STRING_START = "STRING_START" // "Hello ${
+	STRING_PART  = "STRING_PART"  // }, you have ${
+	STRING_END   = "STRING_END"   // } items"
 )
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"if":     IF,
-	"else":   ELSE,
-	"true":   TRUE,
-	"false":  FALSE,
-	"return": RETURN,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"const":    CONST,
+	"if":       IF,
+	"else":     ELSE,
+	"true":     TRUE,
+	"false":    FALSE,
+	"return":   RETURN,
+	"try":      TRY,
+	"catch":    CATCH,
+	"finally":  FINALLY,
+	"throw":    THROW,
+	"while":    WHILE,
+	"for":      FOR,
+	"in":       IN,
+	"break":    BREAK,
+	"continue": CONTINUE,
 }
 
 // LookupIdent checks to see if the given string is a keyword
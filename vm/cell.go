@@ -0,0 +1,68 @@
+// vm/cell.go
+//
+// defines the cells through which closures share the variables they capture
+
+package vm
+
+import "../object"
+
+const CELL_OBJ = "CELL"
+
+// cell holds a captured variable. While the variable's frame is running the
+// cell is open and the variable lives in its stack slot, where the frame
+// reads and writes it directly; once the slot is released the cell is
+// closed and keeps the last value itself. Only closures hold cells, so they
+// never reach a Monkey program.
+type cell struct {
+	index int // the stack slot of an open cell
+	open  bool
+	value object.Object
+}
+
+func (c *cell) Type() object.ObjectType { return CELL_OBJ }
+func (c *cell) Inspect() string         { return "cell" }
+
+// get returns the value of the variable in c
+func (vm *VM) get(c *cell) object.Object {
+	if c.open {
+		return vm.stack[c.index]
+	}
+	return c.value
+}
+
+// set assigns the variable in c
+func (vm *VM) set(c *cell, value object.Object) {
+	if c.open {
+		vm.stack[c.index] = value
+	} else {
+		c.value = value
+	}
+}
+
+// localCell returns the open cell of the stack slot index, creating it if no
+// closure has captured the slot yet
+func (vm *VM) localCell(index int) *cell {
+	for _, c := range vm.openCells {
+		if c.index == index {
+			return c
+		}
+	}
+
+	c := &cell{index: index, open: true}
+	vm.openCells = append(vm.openCells, c)
+	return c
+}
+
+// closeCells closes the open cells of the stack slots from first up to end
+func (vm *VM) closeCells(first, end int) {
+	open := vm.openCells[:0]
+	for _, c := range vm.openCells {
+		if c.index >= first && c.index < end {
+			c.value = vm.stack[c.index]
+			c.open = false
+		} else {
+			open = append(open, c)
+		}
+	}
+	vm.openCells = open
+}
@@ -0,0 +1,32 @@
+// vm/frame.go
+//
+// defines the call frames of the vm
+
+package vm
+
+import (
+	"../code"
+	"../object"
+	"../token"
+)
+
+// Frame is the state of one function call
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int
+
+	// where the call that replaced the frame was made, for a tail call
+	tailPos token.Position
+}
+
+// NewFrame creates a frame that starts executing cl with its locals at
+// basePointer
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+// Instructions returns the code of the function being executed
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
@@ -0,0 +1,19 @@
+// vm/iterator.go
+//
+// defines the iterator a for loop keeps in a hidden variable
+
+package vm
+
+import "../object"
+
+const ITERATOR_OBJ = "ITERATOR"
+
+// iterator walks the elements of an iterable. Only compiled for loops create
+// one, so it never reaches a Monkey program.
+type iterator struct {
+	elements []object.Object
+	next     int
+}
+
+func (it *iterator) Type() object.ObjectType { return ITERATOR_OBJ }
+func (it *iterator) Inspect() string         { return "iterator" }
@@ -0,0 +1,912 @@
+// vm/vm.go
+//
+// defines the stack virtual machine that executes compiled bytecode
+
+package vm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"../code"
+	"../compiler"
+	"../object"
+)
+
+// StackSize is the initial size of the stack, which grows as needed
+const StackSize = 2048
+
+// GlobalsSize is the number of global bindings a program may make
+const GlobalsSize = 65536
+
+var (
+	True  = object.True
+	False = object.False
+	Null  = &object.Null{}
+)
+
+// operators maps the binary opcodes back to their source operators, so
+// errors read the same as the evaluator's
+var operators = map[code.Opcode]string{
+	code.OpAdd:         "+",
+	code.OpSub:         "-",
+	code.OpMul:         "*",
+	code.OpDiv:         "/",
+	code.OpMod:         "%",
+	code.OpEqual:       "==",
+	code.OpNotEqual:    "!=",
+	code.OpGreaterThan: ">",
+	code.OpLessThan:    "<",
+}
+
+// handler is where a runtime error raised in a try block continues
+type handler struct {
+	frames int // the number of frames when the try block started
+	sp     int
+	ip     int
+}
+
+// Limits bounds the resources a run may use
+type Limits = object.Limits
+
+// VM executes the bytecode of one compilation
+type VM struct {
+	constants   []object.Object
+	globals     []object.Object
+	globalNames []string
+
+	stack []object.Object
+	sp    int // always points to the next free slot, the top is stack[sp-1]
+
+	frames []*Frame
+
+	openCells []*cell // cells of variables still in their stack slots
+
+	handlers []handler // the try blocks being run, innermost last
+
+	budget *object.Budget
+
+	strict bool // whether indexing out of range is an error rather than null
+}
+
+// New creates a vm for bytecode with fresh globals
+func New(bytecode *compiler.Bytecode) *VM {
+	return NewWithGlobalsStore(bytecode, make([]object.Object, GlobalsSize))
+}
+
+// NewWithGlobalsStore creates a vm that reads and writes the globals in s,
+// so they outlive a single run
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		NumLocals:    bytecode.NumLocals,
+		Positions:    bytecode.Positions,
+	}
+	mainClosure := &object.Closure{Fn: mainFn}
+
+	vm := &VM{
+		constants:   bytecode.Constants,
+		globals:     s,
+		globalNames: bytecode.GlobalNames,
+		stack:       make([]object.Object, StackSize),
+		frames:      []*Frame{NewFrame(mainClosure, 0)},
+	}
+	vm.grow(mainFn.NumLocals)
+	vm.sp = mainFn.NumLocals
+	return vm
+}
+
+// SetStrict makes indexing an array or string out of range an error rather
+// than null, like in a strict environment of the evaluator
+func (vm *VM) SetStrict(strict bool) { vm.strict = strict }
+
+// LastPoppedStackElem returns the value of the last expression statement
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.stack[vm.sp]
+}
+
+// Run executes the bytecode with only the default limits applied
+func (vm *VM) Run() error {
+	return vm.RunContext(context.Background(), Limits{})
+}
+
+// RunContext executes the bytecode, stopping with a LIMIT_ERROR when ctx is
+// done or one of the limits is exceeded. Runtime errors are returned as
+// *object.Error, and a panic inside the vm or a builtin as an INTERNAL_ERROR.
+func (vm *VM) RunContext(ctx context.Context, limits Limits) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &object.Error{Kind: object.INTERNAL_ERROR, Message: fmt.Sprintf("internal error: %v", r)}
+		}
+	}()
+
+	budget, cancel := object.NewBudget(ctx, limits)
+	defer cancel()
+	vm.budget = budget
+
+	if err := budget.CheckContext(); err != nil {
+		return err
+	}
+
+	return vm.run(0)
+}
+
+// run executes instructions until the program ends or, when a builtin calls
+// a function, until that call returns and only depth frames are left
+func (vm *VM) run(depth int) error {
+	for {
+		err := vm.execute(depth)
+		errObj, ok := err.(*object.Error)
+		if !ok {
+			return err
+		}
+
+		vm.locate(errObj)
+		if !vm.catch(errObj, depth) {
+			return err
+		}
+	}
+}
+
+// catch unwinds the stack to the innermost handler of this run, if there is
+// one, and continues there with the error as a value. Only runtime errors
+// can be caught.
+func (vm *VM) catch(err *object.Error, depth int) bool {
+	if err.Kind != object.RUNTIME_ERROR || len(vm.handlers) == 0 {
+		return false
+	}
+
+	h := vm.handlers[len(vm.handlers)-1]
+	if h.frames <= depth {
+		return false
+	}
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+	for len(vm.frames) > h.frames {
+		vm.popFrame()
+	}
+	vm.sp = h.sp
+	vm.currentFrame().ip = h.ip - 1
+	vm.push(&object.ErrorValue{Err: err})
+
+	return true
+}
+
+// unwind drops the frames and handlers above depth, after a call made for a
+// builtin failed
+func (vm *VM) unwind(depth, sp int) {
+	for len(vm.frames) > depth {
+		vm.popFrame()
+	}
+	for len(vm.handlers) > 0 && vm.handlers[len(vm.handlers)-1].frames > depth {
+		vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	}
+	vm.sp = sp
+}
+
+// locate places an error at the source of the instruction that raised it
+// and attaches the calls active, unless a deeper call already did
+func (vm *VM) locate(err *object.Error) {
+	if !err.Pos.IsValid() {
+		frame := vm.currentFrame()
+		err.Pos = frame.cl.Fn.PositionOf(frame.ip)
+	}
+	if err.Trace == nil && len(vm.frames) > 1 {
+		err.Trace = vm.trace()
+	}
+}
+
+// trace describes the calls active, innermost first, leaving out the main
+// program
+func (vm *VM) trace() []object.Frame {
+	trace := make([]object.Frame, 0, len(vm.frames)-1)
+	for i := len(vm.frames) - 1; i > 0; i-- {
+		frame, caller := vm.frames[i], vm.frames[i-1]
+
+		pos := frame.tailPos
+		if !pos.IsValid() {
+			pos = caller.cl.Fn.PositionOf(caller.ip)
+		}
+		trace = append(trace, object.Frame{Function: frame.cl.Fn.Name, Pos: pos})
+	}
+	return trace
+}
+
+func (vm *VM) execute(depth int) error {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for len(vm.frames) > depth && vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		if err := vm.budget.Step(); err != nil {
+			return err
+		}
+
+		vm.currentFrame().ip++
+
+		ip = vm.currentFrame().ip
+		ins = vm.currentFrame().Instructions()
+		op = code.Opcode(ins[ip])
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			vm.push(vm.constants[constIndex])
+
+		case code.OpPop:
+			vm.pop()
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+			code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan:
+			if err := vm.executeBinaryOperation(op); err != nil {
+				return err
+			}
+
+		case code.OpTrue:
+			vm.push(True)
+
+		case code.OpFalse:
+			vm.push(False)
+
+		case code.OpNull:
+			vm.push(Null)
+
+		case code.OpBang:
+			vm.push(nativeBoolToBooleanObject(!isTruthy(vm.pop())))
+
+		case code.OpMinus:
+			result := object.Negate(vm.pop())
+			if errObj, ok := result.(*object.Error); ok {
+				return errObj
+			}
+			vm.push(result)
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip = pos - 1
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			if !isTruthy(vm.pop()) {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpJumpIfSet:
+			localIndex := int(code.ReadUint8(ins[ip+1:]))
+			pos := int(code.ReadUint16(ins[ip+2:]))
+			vm.currentFrame().ip += 3
+
+			if vm.stack[vm.currentFrame().basePointer+localIndex] != nil {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			vm.globals[globalIndex] = vm.pop()
+
+		case code.OpGetGlobal:
+			globalIndex := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			val := vm.globals[globalIndex]
+			if val == nil {
+				return newError("identifier not found: %s", vm.globalName(globalIndex))
+			}
+			vm.push(val)
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+
+			frame := vm.currentFrame()
+			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+
+			frame := vm.currentFrame()
+			vm.push(vm.stack[frame.basePointer+int(localIndex)])
+
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+
+			vm.push(object.Builtins[builtinIndex].Builtin)
+
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+
+			cl := vm.currentFrame().cl
+			val := vm.get(cl.Free[freeIndex].(*cell))
+			if val == nil {
+				return newError("identifier not found: %s", cl.Fn.FreeNames[freeIndex])
+			}
+			vm.push(val)
+
+		case code.OpSetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+
+			// a variable bound after the closure is undeclared until its
+			// let has run
+			cl := vm.currentFrame().cl
+			c := cl.Free[freeIndex].(*cell)
+			if vm.get(c) == nil {
+				return newError("cannot assign to undeclared identifier: %s", cl.Fn.FreeNames[freeIndex])
+			}
+			vm.set(c, vm.pop())
+
+		case code.OpGetLocalCell:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+
+			vm.push(vm.localCell(vm.currentFrame().basePointer + int(localIndex)))
+
+		case code.OpGetFreeCell:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+
+			vm.push(vm.currentFrame().cl.Free[freeIndex])
+
+		case code.OpCell:
+			vm.push(&cell{value: vm.pop()})
+
+		case code.OpCloseCells:
+			first := vm.currentFrame().basePointer + int(code.ReadUint8(ins[ip+1:]))
+			count := int(code.ReadUint8(ins[ip+2:]))
+			vm.currentFrame().ip += 2
+
+			vm.closeCells(first, first+count)
+
+		case code.OpCurrentClosure:
+			vm.push(vm.currentFrame().cl)
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			elements := make([]object.Object, numElements)
+			copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+			vm.sp = vm.sp - numElements
+
+			array := &object.Array{Elements: elements}
+			if err := vm.budget.Track(array); err != nil {
+				return err
+			}
+			vm.push(array)
+
+		case code.OpConcat:
+			numParts := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			var out strings.Builder
+			for _, part := range vm.stack[vm.sp-numParts : vm.sp] {
+				if str, ok := part.(*object.String); ok {
+					out.WriteString(str.Value)
+				} else {
+					out.WriteString(part.Inspect())
+				}
+			}
+			vm.sp = vm.sp - numParts
+
+			str := &object.String{Value: out.String()}
+			if err := vm.budget.Track(str); err != nil {
+				return err
+			}
+			vm.push(str)
+
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
+			if err != nil {
+				return err
+			}
+			vm.sp = vm.sp - numElements
+
+			if err := vm.budget.Track(hash); err != nil {
+				return err
+			}
+			vm.push(hash)
+
+		case code.OpHashKey:
+			key := vm.stack[vm.sp-1]
+			if _, ok := key.(object.Hashable); !ok {
+				return newError("unusable as hash key: %s", key.Type())
+			}
+
+		case code.OpIter:
+			iterable := vm.pop()
+
+			elements, ok := object.Iterate(iterable)
+			if !ok {
+				return newError("cannot iterate over %s", iterable.Type())
+			}
+			vm.push(&iterator{elements: elements})
+
+		case code.OpIterNext:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			it := vm.pop().(*iterator)
+			if it.next == len(it.elements) {
+				vm.currentFrame().ip = pos - 1
+			} else {
+				vm.push(it.elements[it.next])
+				it.next++
+			}
+
+		case code.OpSetIndex:
+			op := code.Opcode(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip++
+
+			val := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+
+			if err := vm.executeSetIndex(left, index, val, op); err != nil {
+				return err
+			}
+
+		case code.OpThrow:
+			return object.Thrown(vm.pop())
+
+		case code.OpTry:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			vm.handlers = append(vm.handlers, handler{frames: len(vm.frames), sp: vm.sp, ip: pos})
+
+		case code.OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+
+			if err := vm.executeIndexExpression(left, index); err != nil {
+				return err
+			}
+
+		case code.OpSlice:
+			step := vm.pop()
+			end := vm.pop()
+			start := vm.pop()
+			left := vm.pop()
+
+			result := object.Slice(left, start, end, step)
+			if errObj, ok := result.(*object.Error); ok {
+				return errObj
+			}
+			if err := vm.budget.Track(result); err != nil {
+				return err
+			}
+			vm.push(result)
+
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+
+			if err := vm.executeCall(int(numArgs)); err != nil {
+				return err
+			}
+
+		case code.OpTailCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+
+			if err := vm.executeTailCall(int(numArgs)); err != nil {
+				return err
+			}
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+
+			if len(vm.frames) == 1 {
+				// a return at the top level ends the program, leaving its
+				// value where LastPoppedStackElem finds it
+				return nil
+			}
+
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			vm.push(returnValue)
+
+		case code.OpReturn:
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			vm.push(Null)
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+
+			if err := vm.pushClosure(int(constIndex), int(numFree)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Kind: object.RUNTIME_ERROR, Message: fmt.Sprintf(format, a...)}
+}
+
+func (vm *VM) globalName(index int) string {
+	if index < len(vm.globalNames) {
+		return vm.globalNames[index]
+	}
+	return fmt.Sprintf("global %d", index)
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[len(vm.frames)-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) {
+	vm.frames = append(vm.frames, f)
+}
+
+// popFrame closes the cells of the frame's locals, whose slots are released
+func (vm *VM) popFrame() *Frame {
+	f := vm.frames[len(vm.frames)-1]
+	vm.frames = vm.frames[:len(vm.frames)-1]
+	vm.closeCells(f.basePointer, len(vm.stack))
+	return f
+}
+
+// grow makes sure the stack has room for size slots
+func (vm *VM) grow(size int) {
+	for size > len(vm.stack) {
+		vm.stack = append(vm.stack, make([]object.Object, len(vm.stack))...)
+	}
+}
+
+func (vm *VM) push(o object.Object) {
+	vm.grow(vm.sp + 1)
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+func (vm *VM) executeBinaryOperation(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	result := object.Infix(operators[op], left, right)
+	if errObj, ok := result.(*object.Error); ok {
+		return errObj
+	}
+	if err := vm.budget.Track(result); err != nil {
+		return err
+	}
+	vm.push(result)
+	return nil
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) (*object.Hash, error) {
+	pairs := make(map[object.HashKey]object.HashPair)
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, newError("unusable as hash key: %s", key.Type())
+		}
+
+		pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	return &object.Hash{Pairs: pairs}, nil
+}
+
+func (vm *VM) executeIndexExpression(left, index object.Object) error {
+	switch {
+	case (left.Type() == object.ARRAY_OBJ || left.Type() == object.STRING_OBJ) && index.Type() == object.INTEGER_OBJ:
+		result := object.IndexSequence(left, index, vm.strict)
+		if errObj, ok := result.(*object.Error); ok {
+			return errObj
+		}
+		if result == nil {
+			result = Null
+		}
+		vm.push(result)
+		return nil
+	case left.Type() == object.HASH_OBJ:
+		return vm.executeHashIndex(left, index)
+	case left.Type() == object.ERROR_VALUE_OBJ && index.Type() == object.STRING_OBJ:
+		field, ok := left.(*object.ErrorValue).Field(index.(*object.String).Value)
+		if !ok {
+			field = Null
+		}
+		vm.push(field)
+		return nil
+	default:
+		return newError("index operator not supported: %s", left.Type())
+	}
+}
+
+// executeSetIndex stores val at index in left and pushes it. A non-zero op
+// combines the element's current value with val first.
+func (vm *VM) executeSetIndex(left, index, val object.Object, op code.Opcode) error {
+	if op != 0 {
+		if err := vm.executeIndexExpression(left, index); err != nil {
+			return err
+		}
+		vm.push(val)
+		if err := vm.executeBinaryOperation(op); err != nil {
+			return err
+		}
+		val = vm.pop()
+	}
+
+	switch left := left.(type) {
+	case *object.Array:
+		if index.Type() != object.INTEGER_OBJ {
+			return newError("array index must be INTEGER, got %s", index.Type())
+		}
+		i, ok := object.ElementIndex(index, len(left.Elements))
+		if !ok {
+			return newError("index out of range: %s", index.Inspect())
+		}
+		left.Elements[i] = val
+
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		hashKey := key.HashKey()
+		if _, ok := left.Pairs[hashKey]; !ok {
+			if err := vm.budget.Allocate(1); err != nil {
+				return err
+			}
+		}
+		left.Pairs[hashKey] = object.HashPair{Key: index, Value: val}
+
+	default:
+		return newError("index assignment not supported: %s", left.Type())
+	}
+
+	vm.push(val)
+	return nil
+}
+
+func (vm *VM) executeHashIndex(hash, index object.Object) error {
+	hashObject := hash.(*object.Hash)
+
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", index.Type())
+	}
+
+	pair, ok := hashObject.Pairs[key.HashKey()]
+	if !ok {
+		vm.push(Null)
+		return nil
+	}
+
+	vm.push(pair.Value)
+	return nil
+}
+
+func (vm *VM) executeCall(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return newError("not a function: %s", callee.Type())
+	}
+}
+
+// executeTailCall calls a function in place of the current one, so tail
+// recursion runs in constant space. Builtins are called as usual, and the
+// instruction after the call returns their result.
+func (vm *VM) executeTailCall(numArgs int) error {
+	callee, ok := vm.stack[vm.sp-1-numArgs].(*object.Closure)
+	if !ok {
+		return vm.executeCall(numArgs)
+	}
+
+	// a bad call fails in the frame that made it
+	if err := checkArity(callee.Fn, numArgs); err != nil {
+		return err
+	}
+
+	frame := vm.popFrame()
+	pos := frame.cl.Fn.PositionOf(frame.ip)
+
+	// the callee and arguments take the place of those of the frame
+	base := frame.basePointer - 1
+	copy(vm.stack[base:], vm.stack[vm.sp-1-numArgs:vm.sp])
+	vm.sp = base + 1 + numArgs
+
+	if err := vm.callClosure(callee, numArgs); err != nil {
+		return err
+	}
+	vm.currentFrame().tailPos = pos
+	return nil
+}
+
+// callClosure sets up the frame of a call. Missing parameters are left nil
+// for the default prologue to fill in, and extra arguments are moved into the
+// rest array.
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	if len(vm.frames)-1 >= vm.budget.MaxDepth() {
+		return object.NewLimitError("call depth limit exceeded: %d", vm.budget.MaxDepth())
+	}
+
+	fn := cl.Fn
+	if err := checkArity(fn, numArgs); err != nil {
+		return err
+	}
+
+	basePointer := vm.sp - numArgs
+	vm.grow(basePointer + fn.NumLocals)
+
+	local := numArgs
+	if fn.HasRest {
+		rest := []object.Object{}
+		if numArgs > fn.NumParameters {
+			rest = append(rest, vm.stack[basePointer+fn.NumParameters:vm.sp]...)
+			local = fn.NumParameters
+		}
+
+		array := &object.Array{Elements: rest}
+		if err := vm.budget.Track(array); err != nil {
+			return err
+		}
+
+		for ; local < fn.NumParameters; local++ {
+			vm.stack[basePointer+local] = nil
+		}
+		vm.stack[basePointer+local] = array
+		local++
+	}
+
+	for ; local < fn.NumParameters; local++ {
+		vm.stack[basePointer+local] = nil
+	}
+	for ; local < fn.NumLocals; local++ {
+		vm.stack[basePointer+local] = nil
+	}
+
+	vm.pushFrame(NewFrame(cl, basePointer))
+	vm.sp = basePointer + fn.NumLocals
+
+	return nil
+}
+
+// checkArity makes sure numArgs fits the parameters of fn, counting defaults
+// and a rest parameter
+func checkArity(fn *object.CompiledFunction, numArgs int) error {
+	required := fn.NumRequired
+	max := fn.NumParameters
+
+	if numArgs >= required && (numArgs <= max || fn.HasRest) {
+		return nil
+	}
+
+	var want string
+	switch {
+	case fn.HasRest:
+		want = fmt.Sprintf("at least %d", required)
+	case required == max:
+		want = fmt.Sprintf("%d", max)
+	default:
+		want = fmt.Sprintf("%d to %d", required, max)
+	}
+
+	return newError("wrong number of arguments to %s. got=%d, want=%s", fn.Describe(), numArgs, want)
+}
+
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := make([]object.Object, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+
+	result := builtin.Call(vm.callFunction, vm.budget, args...)
+	vm.sp = vm.sp - numArgs - 1
+
+	switch result := result.(type) {
+	case nil:
+		vm.push(Null)
+		return nil
+	case *object.Error:
+		return result
+	}
+
+	if err := vm.budget.Track(result); err != nil {
+		return err
+	}
+	vm.push(result)
+	return nil
+}
+
+// callFunction calls fn for a builtin, running the vm until it returns
+func (vm *VM) callFunction(fn object.Object, args ...object.Object) object.Object {
+	depth, sp := len(vm.frames), vm.sp
+
+	vm.push(fn)
+	for _, arg := range args {
+		vm.push(arg)
+	}
+
+	if err := vm.executeCall(len(args)); err != nil {
+		vm.unwind(depth, sp)
+		return errorObject(err)
+	}
+	if err := vm.run(depth); err != nil {
+		vm.unwind(depth, sp)
+		return errorObject(err)
+	}
+
+	return vm.pop()
+}
+
+// errorObject returns err as it is if it is a Monkey error
+func errorObject(err error) *object.Error {
+	if errObj, ok := err.(*object.Error); ok {
+		return errObj
+	}
+	return &object.Error{Kind: object.INTERNAL_ERROR, Message: err.Error()}
+}
+
+func (vm *VM) pushClosure(constIndex, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", constant)
+	}
+
+	free := make([]object.Object, numFree)
+	copy(free, vm.stack[vm.sp-numFree:vm.sp])
+	vm.sp = vm.sp - numFree
+
+	vm.push(&object.Closure{Fn: function, Free: free})
+	return nil
+}
+
+func isTruthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		return obj.Value
+	case *object.Null:
+		return false
+	default:
+		return true
+	}
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return True
+	}
+	return False
+}
@@ -0,0 +1,1550 @@
+// vm/vm_test.go
+//
+// unit tests for the vm, running the same programs as the evaluator tests
+
+package vm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"../ast"
+	"../code"
+	"../compiler"
+	"../lexer"
+	"../object"
+	"../parser"
+)
+
+func TestStrictIndex(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`[1, 2][-2]`, "1"},
+		{`[1, 2][2]`, "index out of range: 2"},
+		{`"ab"[-3]`, "index out of range: -3"},
+		{`[1, 2][1:5]`, "[2]"},
+		{`{"a": 1}["b"]`, "null"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		machine := New(comp.Bytecode())
+		machine.SetStrict(true)
+
+		var got string
+		if err := machine.Run(); err != nil {
+			got = err.(*object.Error).Message
+		} else {
+			got = machine.LastPoppedStackElem().Inspect()
+		}
+		if got != tt.expected {
+			t.Errorf("wrong result for %s. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestSlicing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`[1, 2, 3, 4, 5][1:3]`, "[2, 3]"},
+		{`[1, 2, 3, 4, 5][:-1]`, "[1, 2, 3, 4]"},
+		{`[1, 2, 3, 4, 5][-2:]`, "[4, 5]"},
+		{`[1, 2, 3, 4, 5][::2]`, "[1, 3, 5]"},
+		{`[1, 2, 3, 4, 5][1::2]`, "[2, 4]"},
+		{`[1, 2, 3, 4, 5][::-1]`, "[5, 4, 3, 2, 1]"},
+		{`[1, 2, 3, 4, 5][3:0:-1]`, "[4, 3, 2]"},
+		{`[1, 2, 3, 4, 5][-10:10]`, "[1, 2, 3, 4, 5]"},
+		{`[1, 2, 3, 4, 5][4:1]`, "[]"},
+		{`[1, 2, 3][:]`, "[1, 2, 3]"},
+		{`[1, 2, 3][::100000000000000000000]`, "[1]"},
+		{`"héllo"[1:3]`, "él"},
+		{`"monkey"[::-1]`, "yeknom"},
+		{`"monkey"[-3:]`, "key"},
+		{`"monkey"[-1] + "monkey"[-6]`, "ym"},
+		{`let a = [1, 2, 3]; let b = a[:]; b[0] = 9; a`, "[1, 2, 3]"},
+		{`let a = [1, 2, 3]; a[-1] = 9; a`, "[1, 2, 9]"},
+		{`let a = [1, 2, 3]; a[-1] += 1; a`, "[1, 2, 4]"},
+		{`let n = 2; [1, 2, 3, 4][n - 1:n + 1]`, "[2, 3]"},
+		{`[1, 2, 3][::0]`, "slice step cannot be zero"},
+		{`[1, 2, 3]["a":]`, "slice bounds must be INTEGER, got STRING"},
+		{`{"a": 1}[1:]`, "slice operator not supported: HASH"},
+		{`let a = [1, 2, 3]; a[-4] = 0`, "index out of range: -4"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		got := evaluated.Inspect()
+		if errObj, ok := evaluated.(*object.Error); ok {
+			got = errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("wrong result for %s. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestStringInterpolation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let name = "Ann"; "Hello ${name}!"`, "Hello Ann!"},
+		{`let items = [1, 2]; "${len(items)} items: ${items}"`, "2 items: [1, 2]"},
+		{`"${1 + 2}${true}${1.5}${first([])}"`, "3true1.5null"},
+		{`"${"nested ${"a" + "b"}"}"`, "nested ab"},
+		{`"${ {"k": 1}["k"] }"`, "1"},
+		{`let f = fn(x) { "<${x}>" }; f("a") + f(2)`, "<a><2>"},
+		{`"a\${b}\n"`, "a${b}\n"},
+		{"`${raw}`", "${raw}"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		got := evaluated.Inspect()
+		if errObj, ok := evaluated.(*object.Error); ok {
+			got = errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("wrong result for %s. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestStringBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`split("a,b,,c", ",")`, "[a, b, , c]"},
+		{"split(\"  a b\n c \")", "[a, b, c]"},
+		{`join(split("a b c"), "-")`, "a-b-c"},
+		{"trim(\"  hi \n\")", "hi"},
+		{`trim("xxhixx", "x")`, "hi"},
+		{`trim_left("  hi  ") + "|"`, "hi  |"},
+		{`"|" + trim_right("  hi  ")`, "|  hi"},
+		{`trim_right("hi!!", "!")`, "hi"},
+		{`upper("MiXed")`, "MIXED"},
+		{`lower("MiXed")`, "mixed"},
+		{`replace("a-b-c", "-", "+")`, "a+b+c"},
+		{`replace("a-b-c", "-", "", 1)`, "ab-c"},
+		{`contains("monkey", "key")`, "true"},
+		{`contains("monkey", "dog")`, "false"},
+		{`[starts_with("monkey", "mon"), ends_with("monkey", "mon")]`, "[true, false]"},
+		{`index_of("monkey", "key")`, "3"},
+		{`index_of("monkey", "z")`, "-1"},
+		{`substring("monkey", 1, 3)`, "on"},
+		{`substring("monkey", -3)`, "key"},
+		{`slice("monkey", 0, 100)`, "monkey"},
+		{`repeat("ab", 3)`, "ababab"},
+		{`repeat("ab", -1)`, "count given to `repeat` must be a non-negative INTEGER, got -1"},
+		{`pad("7", 3, "0")`, "007"},
+		{`pad("ab", -4) + "|"`, "ab  |"},
+		{`pad("abcdef", 3)`, "abcdef"},
+		{`pad("a", 3, "xy")`, "fill given to `pad` must be a single character, got xy"},
+		{`chars("abc")`, "[a, b, c]"},
+		{`bytes("hé")`, "[104, 195, 169]"},
+		{`[len("héllo"), len(bytes("héllo"))]`, "[5, 6]"},
+		{`index_of("héllo", "l")`, "2"},
+		{`slice("héllo", 1, 3)`, "él"},
+		{`substring("日本語", -2)`, "本語"},
+		{`["héllo"[1], "héllo"[4], "héllo"[5]]`, "[é, o, null]"},
+		{`let größe = "λ"; größe + größe`, "λλ"},
+		{`str(12) + str(1.5) + str(true) + str(first([])) + str("s")`, "121.5truenulls"},
+		{`str([1, "a"])`, "[1, a]"},
+		{`int("42") + int(2.9)`, "44"},
+		{`int("4x2")`, "could not parse \"4x2\" as integer"},
+		{`int([])`, "argument to `int` not supported, got ARRAY"},
+		{`[bool("true"), bool("false"), bool(0), bool(2), bool(first([])), bool(false)]`, "[true, false, false, true, false, false]"},
+		{`bool("yes")`, "could not parse \"yes\" as boolean"},
+		{`bool([])`, "argument to `bool` not supported, got ARRAY"},
+		{`upper(1)`, "argument to `upper` must be STRING, got INTEGER"},
+		{`contains(1, 1)`, "argument to `contains` must be ARRAY or STRING, got INTEGER"},
+		{`contains("abc", 1)`, "argument to `contains` must be STRING, got INTEGER"},
+		{`split()`, "wrong number of arguments. got=0, want=1 to 2"},
+		{`if (bool("true")) { "yes" } else { "no" }`, "yes"},
+		{`[if (0) { "yes" } else { "no" }, if (bool(0)) { "yes" } else { "no" }]`, "[yes, no]"},
+		{`[if ("false") { "yes" } else { "no" }, if (bool("false")) { "yes" } else { "no" }]`, "[yes, no]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		got := evaluated.Inspect()
+		if errObj, ok := evaluated.(*object.Error); ok {
+			got = errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("wrong result for %s. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestArrayBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`len([1, 2, 3])`, "3"},
+		{`len([])`, "0"},
+		{`first([1, 2, 3])`, "1"},
+		{`first([])`, "null"},
+		{`last([1, 2, 3])`, "3"},
+		{`rest([1, 2, 3])`, "[2, 3]"},
+		{`rest([])`, "null"},
+		{`let a = [1, 2]; let b = push(a, 3, 4); [a, b]`, "[[1, 2], [1, 2, 3, 4]]"},
+		{`let a = [1, 2, 3]; let b = pop(a); [a, b, a[:-1]]`, "[[1, 2, 3], 3, [1, 2]]"},
+		{`pop([])`, "null"},
+		{`concat([1], [], [2, 3])`, "[1, 2, 3]"},
+		{`slice([1, 2, 3, 4], 1, 3)`, "[2, 3]"},
+		{`slice([1, 2, 3, 4], -2)`, "[3, 4]"},
+		{`slice([1, 2, 3, 4], 3, 1)`, "[]"},
+		{`slice([1, 2, 3, 4], 0, 10)`, "[1, 2, 3, 4]"},
+		{`let a = [1, 2, 3]; [reverse(a), a]`, "[[3, 2, 1], [1, 2, 3]]"},
+		{`let a = [3, 1.5, 2]; [sort(a), a]`, "[[1.5, 2, 3], [3, 1.5, 2]]"},
+		{`sort(["b", "c", "a"])`, "[a, b, c]"},
+		{`sort([3, 1, 2], fn(a, b) { a > b })`, "[3, 2, 1]"},
+		{`sort([1, "a"])`, "cannot compare STRING and INTEGER"},
+		{`sort([1, 2], fn(a, b) { 1 })`, "comparator given to `sort` must return BOOLEAN, got INTEGER"},
+		{`contains([1, "a", [2]], [2])`, "true"},
+		{`contains([1, 2], 3)`, "false"},
+		{`index_of([1, 2, 3], 3)`, "2"},
+		{`index_of([1, 2, 3], 1.0)`, "0"},
+		{`index_of([1, 2, 3], 4)`, "-1"},
+		{`join([1, "a", true], ", ")`, "1, a, true"},
+		{`join(["a", "b"])`, "ab"},
+		{`zip([1, 2, 3], ["a", "b"])`, "[[1, a], [2, b]]"},
+		{`range(3)`, "[0, 1, 2]"},
+		{`range(1, 4)`, "[1, 2, 3]"},
+		{`range(10, 0, -3)`, "[10, 7, 4, 1]"},
+		{`range(0, 1, 0)`, "step given to `range` must not be 0"},
+		{`map([1, 2, 3], fn(x) { x * 2 })`, "[2, 4, 6]"},
+		{`map([-1, 2], abs)`, "[1, 2]"},
+		{`filter([1, 2, 3, 4], fn(x) { x % 2 == 0 })`, "[2, 4]"},
+		{`reduce([1, 2, 3], fn(acc, x) { acc + x })`, "6"},
+		{`reduce([1, 2, 3], fn(acc, x) { push(acc, x * x) }, [])`, "[1, 4, 9]"},
+		{`reduce([], fn(acc, x) { acc + x })`, "`reduce` of an empty array needs an initial value"},
+		{`find([1, 2, 3], fn(x) { x > 1 })`, "2"},
+		{`find([1, 2, 3], fn(x) { x > 5 })`, "null"},
+		{`[any([1, 2], fn(x) { x > 1 }), any([], fn(x) { true })]`, "[true, false]"},
+		{`[all([1, 2], fn(x) { x > 1 }), all([], fn(x) { false })]`, "[false, true]"},
+		{`let n = 0; map([1, 2], fn(x) { n += x }); n`, "3"},
+		{`map([1, 2], fn(x) { x / 0 })`, "division by zero"},
+		{`map([1, 2], fn() { 1 })`, "wrong number of arguments to anonymous function. got=1, want=0"},
+		{`map([1], 1)`, "not a function: INTEGER"},
+		{`first(1)`, "argument to `first` must be ARRAY, got INTEGER"},
+		{`let sum = fn(xs) { reduce(xs, fn(a, b) { a + b }, 0) }; sum(map(range(5), fn(x) { x * x }))`, "30"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		got := evaluated.Inspect()
+		if errObj, ok := evaluated.(*object.Error); ok {
+			got = errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("wrong result for %s. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestConst(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"const x = 5; x * 2", 10},
+		{"const x = 5; let f = fn() { let x = 1; x += 1; x }; f() + x", 7},
+		{"const x = 5; x = 6", "compiler error: 1:14: cannot assign to constant: x"},
+		{"const x = 5; let f = fn() { x += 1 }", "compiler error: 1:29: cannot assign to constant: x"},
+		{"const x = 5; let x = 6", "compiler error: 1:18: cannot redeclare constant: x"},
+		{"const x = 1; for (x in [5]) { x }; x", 1},
+		{"let f = fn() { const n = 1; const n = 2 }", "compiler error: 1:35: cannot redeclare constant: n"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = 1; x = 2; x", 2},
+		{"let x = 1; x = 2", 2},
+		{"let x = 10; x += 5; x -= 3; x *= 2; x /= 4; x %= 4; x", 2},
+		{"let a = 1; let b = 2; a = b = 3; a + b", 6},
+		{"let f = fn() { let n = 0; n += 2; n }; f()", 2},
+		{"let x = 1; let f = fn() { x = 3 }; f(); x", 3},
+		{"let total = 0; for (x in [1, 2, 3]) { total += x }; total", 6},
+		{"let a = [1, 2, 3]; a[1] = 5; a[1] + a[2]", 8},
+		{"let a = [1, 2, 3]; a[2] *= 10; a[2]", 30},
+		{"let h = {}; h[\"k\"] = 1; h[\"k\"] += 1; h[\"k\"]", 2},
+		{"let s = \"a\"; s += \"b\"; s", "ab"},
+		{"y = 1", "compiler error: 1:1: cannot assign to undeclared identifier: y"},
+		{"y += 1", "compiler error: 1:1: identifier not found: y"},
+		{"let counter = fn() { let n = 0; fn() { n += 1 } }; let c = counter(); c(); c(); c()", 3},
+		{"let f = fn() { let n = 0; let g = fn() { n = 5 }; g(); n }; f()", 5},
+		{"let f = fn() { let n = 1; let g = fn() { n }; n = 7; g() }; f()", 7},
+		{"let f = fn() { let n = 0; let add = fn() { fn() { n += 1 } }; add()(); add()(); n }; f()", 2},
+		{"let f = fn() { let n = 0; [fn() { n += 1 }, fn() { n }] }; let p = f(); p[0](); p[0](); p[1]()", 2},
+		{"let f = fn(n) { fn() { n = n * 2 } }; let g = f(3); g(); g()", 12},
+		{"let fib = fn() { fib = 1 }; fib(); fib", 1},
+		{"len = 1", "compiler error: 1:1: cannot assign to undeclared identifier: len"},
+		{"let a = [1]; a[1] = 2", "index out of range: 1"},
+		{"let h = {}; h[fn() {}] = 1", "unusable as hash key: FUNCTION"},
+		{"let x = 1; x[0] = 2", "index assignment not supported: INTEGER"},
+		{"let h = {}; h[\"k\"] += 1", "type mismatch: NULL + INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			switch obj := evaluated.(type) {
+			case *object.String:
+				if obj.Value != expected {
+					t.Errorf("wrong value for %q. want=%q, got=%q", tt.input, expected, obj.Value)
+				}
+			case *object.Error:
+				if obj.Message != expected {
+					t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, expected, obj.Message)
+				}
+			default:
+				t.Errorf("object is not String or Error. got=%T (%+v)", evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 0; while (i < 5) { let i = i + 1 }; i", 5},
+		{"let i = 0; while (true) { let i = i + 1; if (i == 3) { break } }; i", 3},
+		{"let f = fn() { let i = 0; while (true) { let i = i + 1; if (i > 2) { return i } } }; f()", 3},
+		{"let f = fn(xs) { for (x in xs) { if (x > 1) { return x } } }; f([1, 2, 3])", 2},
+		{"let f = fn(xs) { for (x in xs) { if (x < 3) { continue }; return x } }; f([1, 2, 3, 4])", 3},
+		{"let f = fn(xs) { let n = 0; for (x in xs) { for (y in xs) { let n = n + 1; if (y == 2) { break } } }; n }; f([1, 2, 3])", 0},
+		{"let f = fn(xs) { let n = 0; for (x in xs) { for (y in xs) { n += 1; if (y == 2) { break } } }; n }; f([1, 2, 3])", 6},
+		{"let last = 0; for (x in [1, 2, 3]) { let last = x }; last", 0},
+		{"let x = 0; for (x in [1, 2]) { x }; x", 0},
+		{"let fs = []; for (i in [1, 2]) { fs = push(fs, fn() { i }) }; fs[0]() + fs[1]() * 10", 21},
+		{"let f = fn(s) { for (c in s) { return c } }; f(\"héllo\")", "h"},
+		{"let f = fn(h) { for (k in h) { return k } }; f({\"b\": 1, \"a\": 2})", "a"},
+		{"for (x in 5) { x }", "cannot iterate over INTEGER"},
+		{"while (true) { 1 / 0 }", "division by zero"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			switch obj := evaluated.(type) {
+			case *object.String:
+				if obj.Value != expected {
+					t.Errorf("wrong value for %q. want=%q, got=%q", tt.input, expected, obj.Value)
+				}
+			case *object.Error:
+				if obj.Message != expected {
+					t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, expected, obj.Message)
+				}
+			default:
+				t.Errorf("object is not String or Error. got=%T (%+v)", evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestThrow(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`throw "bad"`, "bad"},
+		{`throw 42`, "42"},
+		{`let f = fn(x) { if (x > 1) { throw error("too big") }; x }; f(1); f(2)`, "too big"},
+		{`error("not thrown")["message"]`, "not thrown"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch obj := evaluated.(type) {
+		case *object.String:
+			if obj.Value != tt.expected {
+				t.Errorf("wrong value for %q. want=%q, got=%q", tt.input, tt.expected, obj.Value)
+			}
+		case *object.Error:
+			if obj.Message != tt.expected {
+				t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expected, obj.Message)
+			}
+		default:
+			t.Errorf("object is not String or Error. got=%T (%+v)", evaluated, evaluated)
+		}
+	}
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"try { 1 } catch (e) { 2 }", 1},
+		{"try { 1 / 0 } catch (e) { 2 }", 2},
+		{"try { 1 / 0; 3 } catch (e) { e[\"message\"] }", "division by zero"},
+		{"try { throw \"bad\" } catch (e) { e[\"message\"] }", "bad"},
+		{"try { throw 42 } catch (e) { e[\"message\"] }", "42"},
+		{"try { throw error(\"bad\") } catch (e) { e[\"kind\"] }", "RUNTIME_ERROR"},
+		{"let f = fn() { throw \"x\" }; try { f() } catch (e) { e[\"trace\"][0] }", "in `f` called at 1:35"},
+		{"try { try { throw \"inner\" } catch (e) { throw e } } catch (e) { e[\"message\"] }", "inner"},
+		{"let x = 0; try { let x = 1 } finally { 2 }; x", 1},
+		{"let f = fn() { try { return 1 } finally { puts() } }; f()", 1},
+		{"let f = fn() { try { return 1 } finally { return 2 } }; f()", 2},
+		{"try { 1 / 0 } finally { 2 }", "division by zero"},
+		{"try { 1 } catch (e) { 2 } finally { 1 / 0 }", "division by zero"},
+		{"try { 1 / 0 } catch (e) { e[\"missing\"] }", nil},
+		{"let e = error(\"not thrown\"); 1", 1},
+		{"1 + try { 1 + [] } catch (e) { 2 }", 3},
+		{"try { } catch (e) { 1 }", nil},
+		{"let n = 0; try { 1 / 0 } catch (e) { n += 1 } finally { n += 10 }; n", 11},
+		{"let n = 0; try { try { 1 / 0 } finally { n += 1 } } catch (e) { n += 10 }; n", 11},
+		{"let n = 0; try { try { 1 / 0 } catch (e) { throw e } finally { n += 1 } } catch (e) { n }", 1},
+		{"let f = fn() { try { 1 / 0 } catch (e) { return 5 } finally { puts() } }; f()", 5},
+		{"let f = fn() { try { 1 / 0 } catch (e) { return 5 } finally { return 6 } }; f()", 6},
+		{"let n = 0; for (i in [1, 2, 3]) { try { if (i == 2) { break } } finally { n += i } }; n", 3},
+		{"let n = 0; for (i in [1, 2, 3]) { try { if (i == 2) { continue }; n += 10 } finally { n += i } }; n", 26},
+		{"let n = 0; while (n < 5) { try { n += 1; continue } finally { n += 1 } }; n", 6},
+		{"let f = fn() { let g = fn() { [][\"x\"] }; g() + 1 }; try { f() } catch (e) { len(e[\"trace\"]) }", 2},
+		{"let f = fn(x) { if (x == 2) { throw \"two\" }; x }; try { map([1, 2, 3], f) } catch (e) { e[\"message\"] }", "two"},
+		{"let f = fn(x) { try { if (x == 2) { throw \"two\" }; x } catch (e) { 0 } }; map([1, 2, 3], f)[1]", 0},
+		{"let fs = []; for (i in [1, 2]) { try { throw i } catch (e) { fs = push(fs, fn() { e[\"message\"] }) } }; fs[0]() + fs[1]()", "12"},
+		{"let f = fn() { try { 1 / 0 } catch (e) { e } }; let x = f(); f(); x[\"message\"]", "division by zero"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			switch obj := evaluated.(type) {
+			case *object.String:
+				if obj.Value != expected {
+					t.Errorf("wrong value for %q. want=%q, got=%q", tt.input, expected, obj.Value)
+				}
+			case *object.Error:
+				if obj.Message != expected {
+					t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, expected, obj.Message)
+				}
+			default:
+				t.Errorf("object is not String or Error for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestLimitErrorsAreNotCaught(t *testing.T) {
+	input := "let loop = fn() { 1 + loop() }; try { loop() } catch (e) { 1 } finally { 2 }"
+
+	evaluated := testEval(input)
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+	if errObj.Kind != object.LIMIT_ERROR {
+		t.Errorf("wrong kind. got=%s", errObj.Kind)
+	}
+}
+
+func TestDivisionByZero(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1 / 0", "division by zero"},
+		{"5 % 0", "division by zero"},
+		{"123456789012345678901234567890 / 0", "division by zero"},
+		{"123456789012345678901234567890 % 0", "division by zero"},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"123456789012345678901234567891 % 7", 1},
+		{"7.5 % 2", 1.5},
+		{"1 + 2 * 3 % 4", 3},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestPanicBecomesInternalError(t *testing.T) {
+	// popping an empty stack is a bug in the bytecode, not in a program
+	machine := New(&compiler.Bytecode{Instructions: code.Make(code.OpPop)})
+
+	err := machine.Run()
+	errObj, ok := err.(*object.Error)
+	if !ok {
+		t.Fatalf("error is not *object.Error. got=%T (%+v)", err, err)
+	}
+	if errObj.Kind != object.INTERNAL_ERROR {
+		t.Errorf("wrong error kind. got=%s", errObj.Kind)
+	}
+}
+
+func TestIntegerOverflow(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "-9223372036854775809"},
+		{"4294967296 * 4294967296", "18446744073709551616"},
+		{"-9223372036854775808 / -1", "9223372036854775808"},
+		{"-(-9223372036854775807 - 1)", "9223372036854775808"},
+		{"123456789012345678901234567890", "123456789012345678901234567890"},
+		{"123456789012345678901234567890 * 0", "0"},
+		{"9223372036854775808 - 1", "9223372036854775807"},
+		{"9223372036854775808 > 9223372036854775807", "true"},
+		{"9223372036854775808 == 9223372036854775808", "true"},
+		{"{9223372036854775808: 1}[9223372036854775807 + 1]", "1"},
+		{"[1][9223372036854775808]", "null"},
+		{"9223372036854775808 * 0.5", "4.611686018427388e+18"},
+		{"abs(-9223372036854775807 - 1)", "9223372036854775808"},
+		{"int(1e20)", "100000000000000000000"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	if _, ok := testEval("9223372036854775808 - 1").(*object.Integer); !ok {
+		t.Errorf("result that fits in 64 bits is not an Integer")
+	}
+}
+
+func TestFloatExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"3.5", 3.5},
+		{"-2.5", -2.5},
+		{"1.5 + 1.5", 3.0},
+		{"1 + 0.5", 1.5},
+		{"0.5 * 4", 2.0},
+		{"7 / 2", 3},
+		{"7 / 2.0", 3.5},
+		{"1e3 - 1", 999.0},
+		{"1 < 1.5", true},
+		{"2.5 > 3", false},
+		{"1 == 1.0", true},
+		{"0.1 + 0.2 != 0.3", true},
+		{"{1.5: 2}[1.5]", 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestMathBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"abs(-3)", 3},
+		{"abs(-2.5)", 2.5},
+		{"floor(2.7)", 2.0},
+		{"ceil(2.1)", 3.0},
+		{"round(2.5)", 3.0},
+		{"round(2.345, 2)", 2.35},
+		{"sqrt(16)", 4.0},
+		{"pow(2, 10)", 1024.0},
+		{"int(-2.9)", -2},
+		{`int("42")`, 42},
+		{"float(3)", 3.0},
+		{`float("0.25")`, 0.25},
+		{`sqrt("x")`, "argument to `sqrt` not supported, got STRING"},
+		{`int("x")`, `could not parse "x" as integer`},
+		{"pow(2)", "wrong number of arguments. got=1, want=2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestFunctionArity(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"fn(a, b) { a }(1)", "wrong number of arguments to anonymous function. got=1, want=2"},
+		{"let add = fn(a, b) { a + b }; add(1, 2, 3)", "wrong number of arguments to `add`. got=3, want=2"},
+		{"let f = fn() { 1 }; f(1)", "wrong number of arguments to `f`. got=1, want=0"},
+		{"let f = fn(a, b = 2) { a + b }; f()", "wrong number of arguments to `f`. got=0, want=1 to 2"},
+		{"let f = fn(a, ...rest) { a }; f()", "wrong number of arguments to `f`. got=0, want=at least 1"},
+		{"let f = fn(a, b = 2) { a + b }; f(1)", 3},
+		{"let f = fn(a, b = 2) { a + b }; f(1, 5)", 6},
+		{"let f = fn(a, b = a * 10, c = a + b) { c }; f(1)", 11},
+		{"let f = fn(a = d) { a }; let d = 2; f(1)", 1},
+		{"let f = fn(a = d) { a }; let d = 2; f()", 2},
+		{"let f = fn(a = missing) { a }; f()", "compiler error: 1:16: identifier not found: missing"},
+		{"let f = fn(a, ...rest) { rest }; f(1)", []int64{}},
+		{"let f = fn(a, ...rest) { rest }; f(1, 2, 3)", []int64{2, 3}},
+		{"let f = fn(a = 0, ...rest) { [a, rest] }; f()[1]", []int64{}},
+		{"let f = fn(...all) { all }; f(4, 5)", []int64{4, 5}},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case []int64:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("object is not Array for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if len(array.Elements) != len(expected) {
+				t.Errorf("wrong number of elements for %q. got=%d", tt.input, len(array.Elements))
+				continue
+			}
+			for i, el := range expected {
+				testIntegerObject(t, array.Elements[i], el)
+			}
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestGlobalsStore(t *testing.T) {
+	globals := make([]object.Object, GlobalsSize)
+	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+	constants := []object.Object{}
+
+	var result object.Object
+	for _, input := range []string{"let x = 20;", "let add = fn(a) { a + x };", "add(1)"} {
+		comp := compiler.NewWithState(symbolTable, constants)
+		if err := comp.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		constants = comp.Bytecode().Constants
+
+		machine := NewWithGlobalsStore(comp.Bytecode(), globals)
+		if err := machine.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		result = machine.LastPoppedStackElem()
+	}
+
+	testIntegerObject(t, result, 21)
+}
+
+func TestIteratorIsDropped(t *testing.T) {
+	for _, input := range []string{"for (x in [1, 2]) { x }", "for (x in [1, 2]) { break }"} {
+		globals := make([]object.Object, GlobalsSize)
+		comp := compiler.New()
+		if err := comp.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		machine := NewWithGlobalsStore(comp.Bytecode(), globals)
+		if err := machine.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		if globals[0] != Null {
+			t.Errorf("iterator of %q kept after the loop. got=%v", input, globals[0])
+		}
+		if result := machine.LastPoppedStackElem(); result != Null {
+			t.Errorf("wrong result for %q. got=%v", input, result)
+		}
+	}
+}
+
+func TestStackTrace(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let inner = fn(x) { x / 0 };\nlet outer = fn() { 1 + inner(1) };\nouter();",
+			"ERROR: 1:23: division by zero\n    in `inner` called at 2:24\n    in `outer` called at 3:1"},
+		{"let count = fn(n) { if (n == 0) { fn() { [][\"x\"] }() + 1 } else { count(n - 1) + 1 } };\ncount(3);",
+			"ERROR: 1:44: index operator not supported: ARRAY\n" +
+				"    in anonymous function called at 1:35\n" +
+				"    in `count` called at 1:67\n" +
+				"    ... repeated 2 more times\n" +
+				"    in `count` called at 2:1"},
+		{"let f = fn(x) { x };\nlet g = fn() { f() + 1 };\ng();",
+			"ERROR: 2:16: wrong number of arguments to `f`. got=0, want=1\n    in `g` called at 3:1"},
+		{"let f = fn(x) { x };\nlet g = fn() { f() };\ng();",
+			"ERROR: 2:16: wrong number of arguments to `f`. got=0, want=1\n    in `g` called at 3:1"},
+		{"let f = fn(x) { x + true };\nmap([1], f);",
+			"ERROR: 1:19: type mismatch: INTEGER + BOOLEAN\n    in `f` called at 2:1"},
+		{"let a = [1];\nlet x = 1;\nx += a;", "ERROR: 3:3: type mismatch: INTEGER + ARRAY"},
+		{"let h = {};\nh[[]] = 1;", "ERROR: 2:2: unusable as hash key: ARRAY"},
+		{"for (x in\n 5) { x }", "ERROR: 2:2: cannot iterate over INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect output for %q.\nwant=%q\ngot=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestUndefinedIdentifier(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"foobar", "compiler error: 1:1: identifier not found: foobar"},
+		{"let f = fn() { g() }; f()", "compiler error: 1:16: identifier not found: g"},
+		{"let f = fn() { x }; x = 5; f()", "compiler error: 1:16: identifier not found: x"},
+		{"g(); let g = fn() { 1 }", "compiler error: 1:1: identifier not found: g"},
+		{"let f = fn() { g() }; f(); let g = fn() { 1 }", "identifier not found: g"},
+		{"let h = fn() { let f = fn() { g() }; let r = f(); let g = fn() { 1 }; r }; h()", "identifier not found: g"},
+		{"let h = fn() { let f = fn() { n = 1 }; f(); let n = 0 }; h()", "cannot assign to undeclared identifier: n"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+
+	testIntegerObject(t, testEval("let f = fn() { g() }; let g = fn() { 1 }; f()"), 1)
+	testIntegerObject(t, testEval("let h = fn() { let f = fn() { g() }; let g = fn() { 2 }; f() }; h()"), 2)
+	testIntegerObject(t, testEval("let r = 0; for (i in [1]) { let f = fn() { g() }; let g = fn() { 3 }; r = f() }; r"), 3)
+	testIntegerObject(t, testEval("let f = fn() { while (true) { let g = fn() { n }; let n = 4; return g() } }; f()"), 4)
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let count = fn(n) { if (n == 0) { \"done\" } else { count(n - 1) } }; count(100000)", "done"},
+		{"let sum = fn(n, acc) { if (n == 0) { return acc }; return sum(n - 1, acc + n) }; sum(100000, 0)", 5000050000},
+		{"let f = fn(n, acc) { if (n == 0) { acc } else { f(n - 1, acc + 1) } }; f(200000, 0)", 200000},
+		{"let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } }; let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } }; even(100001)", false},
+		{"let loop = fn(n) { while (true) { if (n == 0) { return 0 }; return loop(n - 1) } }; loop(100000)", 0},
+		{"let f = fn(n) { if (n == 0) { len(\"abc\") } else { f(n - 1) } }; f(20000)", 3},
+		{"let f = fn(n) { if (n == 0) { throw \"bottom\" } else { f(n - 1) } }; try { f(20000) } catch (e) { e[\"message\"] }", "bottom"},
+		{"let f = fn(n) { if (n == 0) { 1 } else { f(n - 1, 2) } }; f(3)", "wrong number of arguments to `f`. got=2, want=1"},
+		{"let f = fn(n, ...rest) { if (n == 0) { len(rest) } else { f(n - 1, 1, 2) } }; f(20000)", 2},
+		{"let f = fn(n) { let g = fn() { n }; if (n == 0) { g } else { f(n - 1) } }; let h = fn(n) { let k = f(n); k() }; h(3)", 0},
+		{"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; map([10000, 20000], f)[1]", 0},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			switch obj := evaluated.(type) {
+			case *object.String:
+				if obj.Value != expected {
+					t.Errorf("wrong value for %q. want=%q, got=%q", tt.input, expected, obj.Value)
+				}
+			case *object.Error:
+				if obj.Message != expected {
+					t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, expected, obj.Message)
+				}
+			default:
+				t.Errorf("object is not String or Error. got=%T (%+v)", evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestTailCallTrace(t *testing.T) {
+	evaluated := testEval(`let inner = fn(x) { x / 0 };
+let outer = fn() { inner(1) };
+outer();`)
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	// the tail call to inner took over the frame of outer
+	want := "ERROR: 1:23: division by zero\n" +
+		"    in `inner` called at 2:20"
+	if errObj.Inspect() != want {
+		t.Errorf("wrong Inspect output.\nwant=%q\ngot=%q", want, errObj.Inspect())
+	}
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		input           string
+		limits          Limits
+		expectedMessage string
+	}{
+		{
+			"let f = fn() { 1 + f() }; f()",
+			Limits{},
+			"call depth limit exceeded: 10000",
+		},
+		{
+			"let f = fn(n) { if (n > 0) { 1 + f(n - 1) } else { n } }; f(50)",
+			Limits{MaxDepth: 10},
+			"call depth limit exceeded: 10",
+		},
+		{
+			"let f = fn(n) { f(n + 1) }; f(0)",
+			Limits{MaxSteps: 1000},
+			"step limit exceeded: 1000",
+		},
+		{
+			"let spin = fn(n) { if (n > 0) { spin(n - 1); spin(n - 1) } }; spin(40)",
+			Limits{Timeout: time.Millisecond},
+			"execution timed out",
+		},
+		{
+			`let f = fn(s) { f(s + s) }; f("ab")`,
+			Limits{MaxAllocations: 1024},
+			"allocation limit exceeded: 1024",
+		},
+		{
+			"[1, 2, 3] + [[4, 5, 6]]",
+			Limits{MaxAllocations: 3},
+			"allocation limit exceeded: 3",
+		},
+		{
+			`repeat("a", 1099511627776)`,
+			Limits{MaxAllocations: 1000},
+			"allocation limit exceeded: 1000",
+		},
+		{
+			`let s = repeat("a", 600); pad(s, -600) + repeat("b", 600)`,
+			Limits{MaxAllocations: 1000},
+			"allocation limit exceeded: 1000",
+		},
+		{
+			`pad("a", 1099511627776, "x")`,
+			Limits{MaxAllocations: 1000},
+			"allocation limit exceeded: 1000",
+		},
+		{
+			"let a = range(600); range(500)",
+			Limits{MaxAllocations: 1000},
+			"allocation limit exceeded: 1000",
+		},
+		{
+			"range(1099511627776)",
+			Limits{MaxAllocations: 1000},
+			"allocation limit exceeded: 1000",
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testRun(context.Background(), tt.input, tt.limits)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Kind != object.LIMIT_ERROR {
+			t.Errorf("wrong error kind for %q. got=%s", tt.input, errObj.Kind)
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestRunContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	evaluated := testRun(ctx, "1 + 1", Limits{})
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+	}
+	if errObj.Kind != object.LIMIT_ERROR || errObj.Message != "execution canceled: context canceled" {
+		t.Errorf("wrong error. got=%s %q", errObj.Kind, errObj.Message)
+	}
+}
+
+func TestHashLiterals(t *testing.T) {
+	input := `let two = "two";
+	{
+		"one": 10 - 9,
+		two: 1 + 1,
+		"thr" + "ee": 6 / 2,
+		4: 4,
+		true: 5,
+		false: 6
+	}`
+
+	evaluated := testEval(input)
+	result, ok := evaluated.(*object.Hash)
+	if !ok {
+		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	expected := map[object.HashKey]int64{
+		(&object.String{Value: "one"}).HashKey():   1,
+		(&object.String{Value: "two"}).HashKey():   2,
+		(&object.String{Value: "three"}).HashKey(): 3,
+		(&object.Integer{Value: 4}).HashKey():      4,
+		True.HashKey():                             5,
+		False.HashKey():                            6,
+	}
+
+	if len(result.Pairs) != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	}
+
+	for expectedKey, expectedValue := range expected {
+		pair, ok := result.Pairs[expectedKey]
+		if !ok {
+			t.Errorf("no pair for given key in Pairs")
+		}
+
+		testIntegerObject(t, pair.Value, expectedValue)
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{"foo": 5}["foo"]`, 5},
+		{`{"foo": 5}["bar"]`, nil},
+		{`let key = "foo"; {"foo": 5}[key]`, 5},
+		{`{}["foo"]`, nil},
+		{`{5: 5}[5]`, 5},
+		{`{true: 5}[true]`, 5},
+		{`{false: 5}[false]`, 5},
+		{`{"a": 1, "a": 2}["a"]`, 2},
+		{`let n = 0; let f = fn(k) { n = n * 10 + k; k }; {f(1): f(2), f(3): f(4)}; n`, 1234},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestHashInspect(t *testing.T) {
+	evaluated := testEval(`{"b": 2, "a": [1, true]}`)
+
+	expected := "{a: [1, true], b: 2}"
+	if evaluated.Inspect() != expected {
+		t.Errorf("wrong Inspect output. expected=%q, got=%q", expected, evaluated.Inspect())
+	}
+}
+
+func TestSelfReferenceInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = [1]; a[0] = a; a", "[[...]]"},
+		{"let h = {}; h[\"x\"] = h; h", "{x: {...}}"},
+		{"let a = [1, 2]; let h = {\"a\": a}; a[1] = h; a", "[1, {a: [...]}]"},
+		{"let a = [1]; a[0] = a; str(a)", "[[...]]"},
+		{"let a = [1, 2]; a[0] = a; join(a, \"-\")", "[...]-2"},
+		{"let a = [1]; a[0] = a; \"${a}\"", "[[...]]"},
+		{"let a = [1]; a[0] = a; let b = [1]; b[0] = b; contains([a], b)", "true"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect output for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestArrayIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{
+			"[1, 2, 3][0]",
+			1,
+		},
+		{
+			"[1, 2, 3][1]",
+			2,
+		},
+		{
+			"[1, 2, 3][2]",
+			3,
+		},
+		{
+			"let i = 0; [1][i];",
+			1,
+		},
+		{
+			"[1, 2, 3][1 + 1];",
+			3,
+		},
+		{
+			"let myArray = [1, 2, 3]; myArray[2];",
+			3,
+		},
+		{
+			"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2]",
+			6,
+		},
+		{
+			"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]",
+			2,
+		},
+		{
+			"[1, 2, 3][3]",
+			nil,
+		},
+		{
+			"[1, 2, 3][-1]",
+			3,
+		},
+		{
+			"[1, 2, 3][-3]",
+			1,
+		},
+		{
+			"[1, 2, 3][-4]",
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	evaluated := testEval(input)
+	result, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(result.Elements) != 3 {
+		t.Fatalf("array has wrong num of elements. got=%d", len(result.Elements))
+	}
+
+	testIntegerObject(t, result.Elements[0], 1)
+	testIntegerObject(t, result.Elements[1], 4)
+	testIntegerObject(t, result.Elements[2], 6)
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("hello world")`, 11},
+		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+func TestStringConcatenation(t *testing.T) {
+	input := `"Hello" + " " + "World!"`
+
+	evaluated := testEval(input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if str.Value != "Hello World!" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+func TestStringLiteral(t *testing.T) {
+	input := `"Hello World!"`
+
+	evaluated := testEval(input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if str.Value != "Hello World!" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+func TestClosures(t *testing.T) {
+	input := `
+let newAdder = fn(x) {
+	fn(y) { x + y };
+};
+
+let addTwo = newAdder(2);
+addTwo(2);`
+
+	testIntegerObject(t, testEval(input), 4)
+}
+
+func TestFunctionApplication(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let identity = fn(x) { return x; }; identity(5);", 5},
+		{"let double = fn(x) { x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestFunctionObject(t *testing.T) {
+	input := "let double = fn(x) { x * 2; }; double"
+
+	evaluated := testEval(input)
+	cl, ok := evaluated.(*object.Closure)
+	if !ok {
+		t.Fatalf("object is not Closure. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if cl.Type() != object.FUNCTION_OBJ {
+		t.Errorf("closure has wrong type. got=%s", cl.Type())
+	}
+	if cl.Fn.NumParameters != 1 || cl.Fn.Name != "double" {
+		t.Errorf("wrong compiled function. got=%+v", cl.Fn)
+	}
+}
+
+func TestLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 5; a;", 5},
+		{"let a = 5 * 5; a;", 25},
+		{"let a = 5; let b = a; b;", 5},
+		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+func TestErrorHandling(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{
+			"5 + true;",
+			"type mismatch: INTEGER + BOOLEAN",
+		},
+		{
+			"5 + true; 5;",
+			"type mismatch: INTEGER + BOOLEAN",
+		},
+		{
+			"-true",
+			"unknown operator: -BOOLEAN",
+		},
+		{
+			"true + false",
+			"unknown operator: BOOLEAN + BOOLEAN",
+		},
+		{
+			"5; true + false; 5",
+			"unknown operator: BOOLEAN + BOOLEAN",
+		},
+		{
+			"if (10 > 1) { true + false; }",
+			"unknown operator: BOOLEAN + BOOLEAN",
+		},
+		{
+			`
+if (10 > 1) {
+	if (10 > 1) {
+		return true + false;
+	}
+
+	return 1;
+}
+		`,
+			"unknown operator: BOOLEAN + BOOLEAN",
+		},
+		{
+			`"Hello" - "World"`,
+			"unknown operator: STRING - STRING",
+		},
+		{
+			`{"name": "Monkey"}[fn(x) { x }];`,
+			"unusable as hash key: FUNCTION",
+		},
+		{
+			`{[1]: 2}`,
+			"unusable as hash key: ARRAY",
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+func TestReturnStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"return 10;", 10},
+		{"return 10; 9;", 10},
+		{"return 2 * 5; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+		{
+			`
+			if (10 > 1) {
+				if (10 > 1) {
+					return 10;
+				}
+				return 1;
+			}
+			`,
+			10,
+		},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestIfElseExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"if (true) { 10 }", 10},
+		{"if (false) { 10}", nil},
+		{"if (1) { 10 }", 10},
+		{"if (1 < 2) { 10 }", 10},
+		{"if (1 > 2) { 10 }", nil},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func testNullObject(t *testing.T, obj object.Object) bool {
+	if obj != Null {
+		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
+		return false
+	}
+	return true
+}
+func TestBangOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"!true", false},
+		{"!false", true},
+		{"!5", false},
+		{"!!true", true},
+		{"!!false", false},
+		{"!!5", true},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestEvalBooleanExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true", true},
+		{"false", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 < 1", false},
+		{"1 > 1", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"1 == 2", false},
+		{"1 != 2", true},
+		{"true == true", true},
+		{"false == false", true},
+		{"true == false", false},
+		{"true != false", true},
+		{"false != true", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
+	result, ok := obj.(*object.Boolean)
+	if !ok {
+		t.Errorf("object is not Boolean. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%t, want=%t", result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
+func TestEvalIntegerExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"5", 5},
+		{"10", 10},
+		{"-5", -5},
+		{"-10", -10},
+		{"5 + 5 + 5 + 5 - 10", 10},
+		{"2 * 2 * 2 * 2 * 2", 32},
+		{"-50 + 100 + -50", 0},
+		{"5 * 2 + 10", 20},
+		{"5 + 2 * 10", 25},
+		{"20 + 2 * -10", 0},
+		{"50 / 2 * 2 + 10", 60},
+		{"2 * (5 + 10)", 30},
+		{"3 * 3 * 3 + 10", 37},
+		{"3 * (3 * 3) + 10", 37},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func testEval(input string) object.Object {
+	return testRun(context.Background(), input, Limits{})
+}
+
+// testRun compiles and runs input, returning the runtime error in place of
+// the result like the evaluator does
+func testRun(ctx context.Context, input string, limits Limits) object.Object {
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		return &object.Error{Message: "compiler error: " + err.Error()}
+	}
+
+	machine := New(comp.Bytecode())
+	if err := machine.RunContext(ctx, limits); err != nil {
+		if errObj, ok := err.(*object.Error); ok {
+			return errObj
+		}
+		return &object.Error{Message: err.Error()}
+	}
+
+	return machine.LastPoppedStackElem()
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("object is not Integer. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%g, want=%g", result.Value, expected)
+		return false
+	}
+	return true
+}